@@ -0,0 +1,139 @@
+package kami
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+)
+
+// CombinedLogger returns a LogHandler that writes a line for each request to w
+// in the Apache combined log format:
+//
+//	%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+//
+// The client is the host of r.RemoteAddr, so use middleware that rewrites RemoteAddr if kami is behind a proxy.
+// The user comes from the URL or basic auth. Missing fields are written as "-",
+// and quotes, backslashes, and control characters are escaped like Apache does.
+// Writes to w are serialized, one line at a time.
+func CombinedLogger(w io.Writer) func(context.Context, mutil.WriterProxy, *http.Request) {
+	var mu sync.Mutex
+	return func(ctx context.Context, proxy mutil.WriterProxy, r *http.Request) {
+		start := time.Now()
+		if req := requestFrom(ctx); req != nil {
+			start = req.start
+		}
+		line := combinedLogLine(proxy, r, start)
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(line)
+	}
+}
+
+// SlowLog returns a LogHandler that writes a line to w for each request that took longer than threshold,
+// counting from StartTime, with its route pattern, status, and duration. Faster requests aren't logged.
+// Writes to w are serialized, one line at a time.
+func SlowLog(threshold time.Duration, w io.Writer) func(context.Context, mutil.WriterProxy, *http.Request) {
+	var mu sync.Mutex
+	return func(ctx context.Context, proxy mutil.WriterProxy, r *http.Request) {
+		start := StartTime(ctx)
+		if start.IsZero() {
+			return
+		}
+		dur := time.Since(start)
+		if dur <= threshold {
+			return
+		}
+		route := "-"
+		if req := requestFrom(ctx); req != nil && req.route != "" {
+			route = req.route
+		}
+		status := proxy.Status()
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		line := fmt.Sprintf("%s slow request: %s %s (route %s) %d %s\n",
+			start.Format(time.RFC3339), r.Method, r.URL.Path, route, status, dur)
+		mu.Lock()
+		defer mu.Unlock()
+		io.WriteString(w, line)
+	}
+}
+
+func combinedLogLine(proxy mutil.WriterProxy, r *http.Request, start time.Time) []byte {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	user := ""
+	if r.URL.User != nil {
+		user = r.URL.User.Username()
+	} else if name, _, ok := r.BasicAuth(); ok {
+		user = name
+	}
+
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+
+	status := proxy.Status()
+	if status == 0 {
+		// kami sends a 500 if nothing was written
+		status = http.StatusInternalServerError
+	}
+
+	buf := make([]byte, 0, 256)
+	buf = appendLogField(buf, host)
+	buf = append(buf, " - "...)
+	buf = appendLogField(buf, user)
+	buf = append(buf, " ["...)
+	buf = start.AppendFormat(buf, "02/Jan/2006:15:04:05 -0700")
+	buf = append(buf, "] \""...)
+	buf = appendLogEscaped(buf, r.Method+" "+uri+" "+r.Proto)
+	buf = append(buf, "\" "...)
+	buf = strconv.AppendInt(buf, int64(status), 10)
+	buf = append(buf, ' ')
+	if n := proxy.BytesWritten(); n > 0 {
+		buf = strconv.AppendInt(buf, int64(n), 10)
+	} else {
+		buf = append(buf, '-')
+	}
+	buf = append(buf, " \""...)
+	buf = appendLogField(buf, r.Referer())
+	buf = append(buf, "\" \""...)
+	buf = appendLogField(buf, r.UserAgent())
+	buf = append(buf, "\"\n"...)
+	return buf
+}
+
+// appendLogField appends s escaped, or "-" if it's blank.
+func appendLogField(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	return appendLogEscaped(buf, s)
+}
+
+// appendLogEscaped escapes quotes, backslashes, and non-printable bytes as \xhh.
+func appendLogEscaped(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20 || c >= 0x7f:
+			buf = append(buf, '\\', 'x', hex[c>>4], hex[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
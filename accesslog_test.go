@@ -0,0 +1,84 @@
+package kami_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestCombinedLogger(t *testing.T) {
+	kami.Reset()
+	var buf bytes.Buffer
+	kami.LogHandler = kami.CombinedLogger(&buf)
+	kami.Get("/hello", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+	kami.Get("/empty", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	expect := []struct {
+		path    string
+		headers map[string]string
+		want    string
+	}{
+		{
+			"/hello?x=1",
+			map[string]string{"Referer": "http://example.com/", "User-Agent": `Mozilla "quoted" \ agent`},
+			`^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /hello\?x=1 HTTP/1\.1" 201 5 "http://example\.com/" "Mozilla \\"quoted\\" \\\\ agent"` + "\n$",
+		},
+		{
+			"/empty",
+			map[string]string{"Authorization": "Basic Ym9iOnNlY3JldA=="}, // bob:secret
+			`^192\.0\.2\.1 - bob \[.+\] "GET /empty HTTP/1\.1" 204 - "-" "-"` + "\n$",
+		},
+	}
+	for _, e := range expect {
+		buf.Reset()
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", e.path, nil)
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if !regexp.MustCompile(e.want).MatchString(buf.String()) {
+			t.Errorf("unexpected log line for %s:\n%q\nshould match %s", e.path, buf.String(), e.want)
+		}
+	}
+}
+
+func TestSlowLog(t *testing.T) {
+	kami.Reset()
+	var buf bytes.Buffer
+	kami.LogHandler = kami.SlowLog(50*time.Millisecond, &buf)
+	kami.Get("/fast", noop)
+	kami.Get("/slow/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if kami.StartTime(ctx).IsZero() {
+			t.Error("StartTime should be set")
+		}
+		time.Sleep(60 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	resp := httptest.NewRecorder()
+	kami.Handler().ServeHTTP(resp, httptest.NewRequest("GET", "/fast", nil))
+	if buf.Len() != 0 {
+		t.Error("fast requests shouldn't be logged:", buf.String())
+	}
+
+	resp = httptest.NewRecorder()
+	kami.Handler().ServeHTTP(resp, httptest.NewRequest("GET", "/slow/1", nil))
+	want := regexp.MustCompile(`^\S+ slow request: GET /slow/1 \(route /slow/:id\) 202 \d+(\.\d+)?ms` + "\n$")
+	if !want.MatchString(buf.String()) {
+		t.Errorf("unexpected log line: %q", buf.String())
+	}
+}
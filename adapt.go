@@ -0,0 +1,33 @@
+package kami
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Adapt turns kami middleware into standard net/http middleware, for using it without kami's router.
+// The middleware runs in order with a context derived from r.Context(), and the handler gets the resulting context
+// through r.Context(). If any of the middleware halts, the handler isn't called.
+// Helpers like Defer, Cancel, and SetWriter work as usual, but there are no URL parameters,
+// and middleware registered with Use doesn't run.
+func Adapt(mw ...Middleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			req := &request{matched: true, cancel: cancel, seq: atomic.AddUint64(&requestSeq, 1), start: time.Now(), url: r.URL, r: r}
+			ctx = newContextWithRequest(ctx, req)
+			defer req.finish()
+
+			req.writer = wrapWriter(w, req)
+			ctx, ok := runChain(ctx, req, r, "", mw)
+			if ok {
+				next.ServeHTTP(req.writer, r.WithContext(ctx))
+			}
+			req.closeWriters()
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestAdapt(t *testing.T) {
+	setUser := func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if _, ok := w.(mutil.WriterProxy); !ok {
+			t.Error("middleware should get a WriterProxy")
+		}
+		return context.WithValue(ctx, "user", r.Header.Get("X-User"))
+	}
+	requireUser := func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if ctx.Value("user") == "" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return nil
+		}
+		return ctx
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Context().Value("user").(string))
+	})
+	handler := kami.Adapt(setUser, requireUser)(mux)
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-User", "kami")
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+	}
+	if body := resp.Body.String(); body != "kami" {
+		t.Error("unexpected body:", body)
+	}
+
+	resp = httptest.NewRecorder()
+	req.Header.Del("X-User")
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Error("should return HTTP StatusUnauthorized(401)", resp.Code, "≠", http.StatusUnauthorized)
+	}
+}
@@ -105,3 +105,21 @@ func BenchmarkMiddleware5(b *testing.B) {
 		}
 	}
 }
+
+// Limit benchmarks concurrent requests contending for slots at the cap
+
+func BenchmarkLimit(b *testing.B) {
+	kami.Reset()
+	kami.Use("/", kami.Limit(4, kami.LimitWait(0)))
+	kami.Get("/test", noop)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/test", nil)
+			kami.Handler().ServeHTTP(resp, req)
+			if resp.Code != http.StatusOK {
+				panic(resp.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package kami
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
+)
+
+// FieldError is an error binding a particular field.
+type FieldError struct {
+	// Field is the name of the struct field, or blank for errors about the whole body.
+	Field string
+	// Source is where the value came from: "path", "query", or "body".
+	// It's blank for errors added to an ErrorBag with Add.
+	Source string
+	// Err is what went wrong.
+	Err error
+}
+
+func (e FieldError) Error() string {
+	switch {
+	case e.Field == "":
+		return e.Source + ": " + e.Err.Error()
+	case e.Source == "":
+		return e.Field + ": " + e.Err.Error()
+	}
+	return e.Source + " " + e.Field + ": " + e.Err.Error()
+}
+
+// BindErrors is a list of errors from binding a request.
+type BindErrors []FieldError
+
+func (errs BindErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// BindJSON decodes a JSON request body into v, using the codec from SetJSONCodec.
+// An empty body gives io.EOF.
+func BindJSON(r *http.Request, v interface{}) error {
+	if r.Body == nil {
+		return errors.New("kami: no request body")
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return io.EOF
+	}
+	return jsonUnmarshal(data, v)
+}
+
+// BindQuery fills the fields of the struct pointed to by v from the URL query, using query:"name" tags.
+// Fields can be strings, bools, numbers, or slices of those for repeated parameters.
+// Missing parameters leave their fields alone.
+// If any values can't be parsed, the rest are still filled in and BindErrors is returned.
+func BindQuery(r *http.Request, v interface{}) error {
+	query := r.URL.Query()
+	errs := bindTags(v, "query", func(name string) []string {
+		return query[name]
+	})
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Bind fills the struct pointed to by v from the request.
+// First, a JSON body is decoded into v using json tags, if the request has one.
+// Then, query parameters are bound to fields with query:"name" tags, like BindQuery.
+// Last, URL parameters are bound to fields with path:"name" tags.
+// Later sources take precedence, so a path parameter overrides the same field from the body.
+// If anything goes wrong, Bind will still try every field and return BindErrors listing each problem.
+func Bind(ctx context.Context, r *http.Request, v interface{}) error {
+	var errs BindErrors
+	if hasBody(r) && r.Body != nil {
+		if err := BindJSON(r, v); err != nil && err != io.EOF {
+			fe := FieldError{Source: "body", Err: err}
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				fe.Field = typeErr.Field
+			}
+			errs = append(errs, fe)
+		}
+	}
+
+	query := r.URL.Query()
+	errs = append(errs, bindTags(v, "query", func(name string) []string {
+		return query[name]
+	})...)
+
+	params, _ := ctx.Value(paramsKey).(httprouter.Params)
+	errs = append(errs, bindTags(v, "path", func(name string) []string {
+		for _, p := range params {
+			if p.Key == name {
+				return []string{p.Value}
+			}
+		}
+		return nil
+	})...)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// bindTags sets the fields of v tagged with tag to the values returned by lookup.
+func bindTags(v interface{}, tag string, lookup func(name string) []string) BindErrors {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return BindErrors{{Source: tag, Err: fmt.Errorf("kami: can't bind to %T, need a pointer to a struct", v)}}
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	var errs BindErrors
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		name := field.Tag.Get(tag)
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+		values := lookup(name)
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(rv.Field(i), values); err != nil {
+			errs = append(errs, FieldError{Field: field.Name, Source: tag, Err: err})
+		}
+	}
+	return errs
+}
+
+func setField(fv reflect.Value, values []string) error {
+	if fv.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setValue(fv, values[0])
+}
+
+func setValue(fv reflect.Value, value string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+type bindTest struct {
+	ID     int      `path:"id" json:"id"`
+	Page   int      `query:"page"`
+	Tags   []string `query:"tag"`
+	Draft  bool     `query:"draft"`
+	Name   string   `json:"name"`
+	Score  float64  `json:"score" query:"score"`
+	hidden string   `query:"hidden"`
+}
+
+func TestBind(t *testing.T) {
+	kami.Reset()
+	var got bindTest
+	var bindErr error
+	kami.Put("/posts/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		got = bindTest{}
+		bindErr = kami.Bind(ctx, r, &got)
+	})
+	kami.Get("/posts/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		got = bindTest{}
+		bindErr = kami.Bind(ctx, r, &got)
+	})
+
+	serve := func(method, path, body string) {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		kami.Handler().ServeHTTP(resp, req)
+	}
+
+	serve("PUT", "/posts/42?page=2&tag=a&tag=b&draft=true&score=1.5&hidden=x", `{"id": 1, "name": "greg", "score": 9}`)
+	if bindErr != nil {
+		t.Error("unexpected error:", bindErr)
+	}
+	expect := bindTest{ID: 42, Page: 2, Tags: []string{"a", "b"}, Draft: true, Name: "greg", Score: 1.5}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected result: %+v ≠ %+v", got, expect)
+	}
+
+	serve("GET", "/posts/7", "")
+	if bindErr != nil {
+		t.Error("unexpected error:", bindErr)
+	}
+	if !reflect.DeepEqual(got, bindTest{ID: 7}) {
+		t.Errorf("unexpected result: %+v", got)
+	}
+
+	serve("PUT", "/posts/abc?page=two&draft=maybe", `{"name": 123}`)
+	errs, ok := bindErr.(kami.BindErrors)
+	if !ok {
+		t.Fatal("expected BindErrors, got", bindErr)
+	}
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Source+"."+err.Field)
+	}
+	expectFields := []string{"body.name", "query.Page", "query.Draft", "path.ID"}
+	if !reflect.DeepEqual(fields, expectFields) {
+		t.Error("unexpected errors:", fields, "≠", expectFields, errs)
+	}
+}
+
+func TestBindQuery(t *testing.T) {
+	req, err := http.NewRequest("GET", "/?page=3&tag=x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bindTest
+	if err := kami.BindQuery(req, &got); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if got.Page != 3 || !reflect.DeepEqual(got.Tags, []string{"x"}) {
+		t.Errorf("unexpected result: %+v", got)
+	}
+	if err := kami.BindQuery(req, got); err == nil {
+		t.Error("binding to a non-pointer should fail")
+	}
+}
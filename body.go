@@ -0,0 +1,74 @@
+package kami
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrBodyTimeout is returned when reading a request body after the time given to ReadTimeout is up.
+var ErrBodyTimeout = errors.New("kami: request body read timed out")
+
+// BufferBody reads the entire request body and replaces it with a copy,
+// so that it can be read again by middleware or the handler.
+func BufferBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	// give back what we read, even if there was an error
+	r.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// ReadTimeout returns middleware that makes reading the request body fail with ErrBodyTimeout
+// once d has passed since kami started handling the request, so a client trickling its body can't hold the handler forever.
+// When served by net/http, the connection's read deadline is set too, so reads that are blocked waiting for the client are interrupted.
+// It only limits time, so it can be combined with http.MaxBytesReader to limit size as well;
+// whichever limit is hit first ends the read.
+// Handlers should answer ErrBodyTimeout with something like 408 Request Timeout.
+func ReadTimeout(d time.Duration) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if r.Body == nil || r.Body == http.NoBody {
+			return ctx
+		}
+		start := time.Now()
+		if req := requestFrom(ctx); req != nil {
+			start = req.start
+		}
+		deadline := start.Add(d)
+		rc := http.NewResponseController(w)
+		if rc.SetReadDeadline(deadline) == nil {
+			Defer(ctx, func() {
+				rc.SetReadDeadline(time.Time{})
+			})
+		}
+		r.Body = &timeoutBody{ReadCloser: r.Body, deadline: deadline}
+		return ctx
+	}
+}
+
+// timeoutBody fails reads after deadline.
+type timeoutBody struct {
+	io.ReadCloser
+	deadline time.Time
+}
+
+func (tb *timeoutBody) Read(p []byte) (int, error) {
+	if !time.Now().Before(tb.deadline) {
+		return 0, ErrBodyTimeout
+	}
+	n, err := tb.ReadCloser.Read(p)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		err = ErrBodyTimeout
+	}
+	return n, err
+}
@@ -0,0 +1,89 @@
+package kami_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+// slowReader returns one byte at a time, waiting before each.
+type slowReader struct {
+	data  string
+	delay time.Duration
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	if len(sr.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(sr.delay)
+	p[0] = sr.data[0]
+	sr.data = sr.data[1:]
+	return 1, nil
+}
+
+func TestReadTimeout(t *testing.T) {
+	kami.Reset()
+	kami.Post("/upload", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if errors.Is(err, kami.ErrBodyTimeout) {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(data)
+	}, kami.ReadTimeout(100*time.Millisecond))
+
+	// fast enough
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/upload", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Body.String() != "hello" {
+		t.Error("fast body should be read", resp.Code, resp.Body.String())
+	}
+
+	// trickling
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/upload", ioutil.NopCloser(&slowReader{data: "hello, world", delay: 30 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusRequestTimeout {
+		t.Error("slow body should time out", resp.Code, "≠", http.StatusRequestTimeout)
+	}
+
+	// stalled over a real connection
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("a"))
+
+	start := time.Now()
+	hresp, err := http.Post(srv.URL+"/upload", "text/plain", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hresp.Body.Close()
+	if hresp.StatusCode != http.StatusRequestTimeout {
+		t.Error("stalled body should time out", hresp.StatusCode, "≠", http.StatusRequestTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("took too long to cut off the client:", elapsed)
+	}
+}
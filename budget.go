@@ -0,0 +1,183 @@
+package kami
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Budget returns middleware that gives the request a total time budget, counted from when kami started handling it,
+// so time spent in earlier middleware is used up too.
+// The context's deadline is set to the end of the budget, so ctx.Done() fires when it runs out.
+// Use Remaining to pass what's left on to calls to other services.
+// If the context already has an earlier deadline, that one is kept.
+func Budget(total time.Duration) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		start := time.Now()
+		if req := requestFrom(ctx); req != nil {
+			start = req.start
+		}
+		ctx, cancel := context.WithDeadline(ctx, start.Add(total))
+		Defer(ctx, cancel)
+		return ctx
+	}
+}
+
+// HeaderTimeoutOption configures HeaderTimeout.
+type HeaderTimeoutOption func(*headerTimeout)
+
+// HeaderTimeoutMax sets the longest timeout a client can ask for with HeaderTimeout; longer ones are cut down to it.
+// The default is one minute.
+func HeaderTimeoutMax(d time.Duration) HeaderTimeoutOption {
+	return func(ht *headerTimeout) {
+		ht.max = d
+	}
+}
+
+// HeaderTimeoutDefault sets the timeout HeaderTimeout uses when the header is missing or invalid.
+// By default, there's none.
+func HeaderTimeoutDefault(d time.Duration) HeaderTimeoutOption {
+	return func(ht *headerTimeout) {
+		ht.def = d
+	}
+}
+
+type headerTimeout struct {
+	max time.Duration
+	def time.Duration
+}
+
+// HeaderTimeout returns middleware that sets the context's deadline from a timeout sent by the client in the named header,
+// like X-Request-Timeout, for service meshes where the caller decides how long it will wait.
+// The value can be a number of seconds (like 2.5) or a Go duration (like 500ms).
+// For the grpc-timeout header, gRPC's format is used instead, like 100m for 100 milliseconds.
+// Timeouts are clamped to the maximum (see HeaderTimeoutMax), so clients can't ask for unbounded deadlines.
+// Missing, invalid, and non-positive values are ignored.
+// If the context already has an earlier deadline, that one is kept.
+func HeaderTimeout(header string, opts ...HeaderTimeoutOption) Middleware {
+	ht := &headerTimeout{max: time.Minute}
+	for _, opt := range opts {
+		opt(ht)
+	}
+	parse := parseTimeout
+	if strings.EqualFold(header, "grpc-timeout") {
+		parse = parseGRPCTimeout
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		d, ok := parse(r.Header.Get(header))
+		if !ok {
+			d = ht.def
+		}
+		if d <= 0 {
+			return ctx
+		}
+		if ht.max > 0 && d > ht.max {
+			d = ht.max
+		}
+		ctx, cancel := context.WithTimeout(ctx, d)
+		Defer(ctx, cancel)
+		return ctx
+	}
+}
+
+// parseTimeout parses seconds, like 1.5, or a Go duration, like 1500ms.
+func parseTimeout(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs <= 0 {
+			return 0, false
+		}
+		if secs > math.MaxInt64/float64(time.Second) {
+			// too big to represent, but HeaderTimeoutMax will cut it down
+			return math.MaxInt64, true
+		}
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	d, err := time.ParseDuration(v)
+	return d, err == nil && d > 0
+}
+
+// parseGRPCTimeout parses a grpc-timeout value: up to 8 digits and a unit, like 100m.
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	var unit time.Duration
+	switch v[len(v)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// Remaining returns how much time is left before ctx's deadline, or zero if it has passed.
+// If ctx has no deadline, it returns the longest possible duration.
+func Remaining(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return math.MaxInt64
+	}
+	if left := time.Until(deadline); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// Retry calls fn up to attempts times until it succeeds, waiting backoff after the first failure,
+// then twice as long after each one after that.
+// It won't outlive the request: it stops early if ctx is cancelled, or if waiting for the next attempt
+// would use up the rest of ctx's deadline (see Budget), so there's no point in trying again.
+// It returns nil if fn succeeded, or fn's last error otherwise.
+// If ctx is already done before the first attempt, it returns ctx.Err() without calling fn.
+// fn is always tried at least once, even if attempts is less than 1.
+func Retry(ctx context.Context, attempts int, backoff time.Duration, fn func(context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	wait := backoff
+	for i := 0; i < attempts; i++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if i == attempts-1 || Remaining(ctx) <= wait {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+	return err
+}
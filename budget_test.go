@@ -0,0 +1,184 @@
+package kami_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestBudget(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		// slow middleware eats into the budget
+		time.Sleep(30 * time.Millisecond)
+		return ctx
+	})
+	kami.Use("/", kami.Budget(100*time.Millisecond))
+
+	var remaining time.Duration
+	var expired bool
+	kami.Get("/work", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		remaining = kami.Remaining(ctx)
+		select {
+		case <-ctx.Done():
+			expired = true
+		case <-time.After(time.Second):
+		}
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/work", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	kami.Handler().ServeHTTP(resp, req)
+	if remaining <= 0 || remaining > 75*time.Millisecond {
+		t.Error("time spent in middleware should count against the budget:", remaining)
+	}
+	if !expired {
+		t.Error("context should be done when the budget runs out")
+	}
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Error("request took too long:", took)
+	}
+
+	if kami.Remaining(context.Background()) <= 0 {
+		t.Error("contexts without deadlines should have time left")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if left := kami.Remaining(ctx); left != 0 {
+		t.Error("expired contexts should have no time left:", left)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	calls := 0
+	flaky := func(succeedOn int) func(context.Context) error {
+		calls = 0
+		return func(ctx context.Context) error {
+			calls++
+			if calls == succeedOn {
+				return nil
+			}
+			return errors.New("flaky " + strconv.Itoa(calls))
+		}
+	}
+
+	// succeeds eventually
+	if err := kami.Retry(context.Background(), 5, time.Millisecond, flaky(3)); err != nil || calls != 3 {
+		t.Error("expected success on the third try:", err, calls)
+	}
+
+	// gives up with the last error
+	if err := kami.Retry(context.Background(), 3, time.Millisecond, flaky(0)); err == nil || err.Error() != "flaky 3" || calls != 3 {
+		t.Error("expected the last error after 3 tries:", err, calls)
+	}
+
+	// fn is tried at least once
+	for _, attempts := range []int{0, -1} {
+		if err := kami.Retry(context.Background(), attempts, time.Millisecond, flaky(0)); err == nil || calls != 1 {
+			t.Error("expected one failed try for", attempts, "attempts:", err, calls)
+		}
+	}
+
+	// stops when the next wait would pass the deadline: 10ms, 20ms, then 40ms doesn't fit
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := kami.Retry(ctx, 10, 10*time.Millisecond, flaky(0)); err == nil {
+		t.Error("expected an error")
+	}
+	if calls != 3 {
+		t.Error("retries should stop before the deadline, calls:", calls)
+	}
+	if elapsed := time.Since(start); elapsed >= 60*time.Millisecond {
+		t.Error("Retry shouldn't wait past the deadline:", elapsed)
+	}
+
+	// cancellation aborts the wait
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	start = time.Now()
+	err := kami.Retry(ctx, 3, time.Minute, func(ctx context.Context) error { return errFlaky })
+	if err != errFlaky {
+		t.Error("expected the last error after cancellation, got", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("cancellation should stop Retry right away, took", elapsed)
+	}
+
+	// already cancelled
+	calls = 0
+	if err := kami.Retry(ctx, 3, time.Millisecond, flaky(1)); err != context.Canceled || calls != 0 {
+		t.Error("expected context.Canceled without calling fn:", err, calls)
+	}
+}
+
+func TestHeaderTimeout(t *testing.T) {
+	var remaining time.Duration
+	var hasDeadline bool
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		_, hasDeadline = ctx.Deadline()
+		remaining = kami.Remaining(ctx)
+	}
+	kami.Reset()
+	kami.Get("/", handler, kami.HeaderTimeout("X-Request-Timeout", kami.HeaderTimeoutMax(10*time.Second)))
+	kami.Get("/default", handler, kami.HeaderTimeout("X-Request-Timeout", kami.HeaderTimeoutDefault(time.Second)))
+	kami.Get("/grpc", handler, kami.HeaderTimeout("Grpc-Timeout"))
+
+	tests := []struct {
+		path, value string
+		want        time.Duration
+	}{
+		{"/", "2", 2 * time.Second},
+		{"/", "0.5", 500 * time.Millisecond},
+		{"/", "1500ms", 1500 * time.Millisecond},
+		{"/", "1h", 10 * time.Second},
+		{"/", "9999999999999", 10 * time.Second},
+		{"/", "", 0},
+		{"/", "soon", 0},
+		{"/", "-5", 0},
+		{"/default", "", time.Second},
+		{"/default", "bogus", time.Second},
+		{"/default", "3s", 3 * time.Second},
+		{"/grpc", "100m", 100 * time.Millisecond},
+		{"/grpc", "2S", 2 * time.Second},
+		{"/grpc", "5H", time.Minute},
+		{"/grpc", "1.5S", 0},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.value != "" {
+			req.Header.Set("X-Request-Timeout", test.value)
+			req.Header.Set("Grpc-Timeout", test.value)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+
+		if test.want == 0 {
+			if hasDeadline {
+				t.Error("expected no deadline for", test.path, test.value, "got", remaining)
+			}
+			continue
+		}
+		if !hasDeadline || remaining > test.want || remaining < test.want-100*time.Millisecond {
+			t.Error("unexpected timeout for", test.path, test.value, remaining, "≠", test.want)
+		}
+	}
+}
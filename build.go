@@ -0,0 +1,49 @@
+package kami
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DeferRegistration makes Handle (and Get, Post, etc.) only record routes instead of adding them to the router.
+// Call Build once everything is registered to add them all at once and check for conflicts.
+// While it's set, HandleSafe never fails, because conflicts are reported by Build instead,
+// and Lookup can't find routes that haven't been built yet.
+var DeferRegistration bool
+
+// Build adds every registered route to a new router, returning Handler() if they can all be registered.
+// Otherwise, it returns RegisterErrors listing every conflict, and the current routes are kept.
+// Build is only needed with DeferRegistration, but it's safe to call either way.
+func Build() (http.Handler, error) {
+	router, errs := buildRouter(registered)
+	if errs != nil {
+		return nil, errs
+	}
+	routes = router
+	return Handler(), nil
+}
+
+// buildRouter makes a new router with the current 404 and 405 handlers, containing regs.
+func buildRouter(regs []route) (Router, RegisterErrors) {
+	router := newRouter()
+	router.NotFound(http.HandlerFunc(handleNotFound))
+	router.MethodNotAllowed(methodNotAllowed)
+
+	var errs RegisterErrors
+	for _, rt := range regs {
+		if err := addRoute(router, rt); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return router, errs
+}
+
+func addRoute(router Router, rt route) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("kami: can't register %s %s: %v", rt.method, rt.path, v)
+		}
+	}()
+	router.Handle(rt.method, rt.path, rt.handle)
+	return nil
+}
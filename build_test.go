@@ -0,0 +1,60 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/guregu/kami"
+)
+
+func TestBuild(t *testing.T) {
+	kami.Reset()
+	defer kami.Reset()
+	kami.DeferRegistration = true
+
+	kami.Get("/users/:id", noop)
+	kami.Get("/users/:name", noop)
+	kami.Get("/users/:id/posts", noop)
+	if err := kami.HandleSafe("GET", "no-slash", noop); err != nil {
+		t.Error("HandleSafe shouldn't fail until Build:", err)
+	}
+
+	// nothing is live yet
+	get := func(h http.Handler, path string) int {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	if code := get(kami.Handler(), "/users/1"); code != http.StatusNotFound {
+		t.Error("routes shouldn't be served before Build", code)
+	}
+
+	h, err := kami.Build()
+	if h != nil {
+		t.Error("Build should fail")
+	}
+	errs, ok := err.(kami.RegisterErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatal("expected 2 RegisterErrors, got", err)
+	}
+
+	// fix the route table and try again
+	kami.Reset()
+	kami.DeferRegistration = true
+	kami.Get("/users/:id", noop)
+	kami.Get("/users/:id/posts", noop)
+	h, err = kami.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/users/1", "/users/1/posts"} {
+		if code := get(h, path); code != http.StatusOK {
+			t.Error("should return HTTP StatusOK(200) for", path, code, "≠", http.StatusOK)
+		}
+	}
+}
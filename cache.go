@@ -0,0 +1,62 @@
+package kami
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// CacheOption is a directive for CacheControl.
+type CacheOption int
+
+const (
+	// CachePublic adds the public directive.
+	CachePublic CacheOption = iota + 1
+	// CachePrivate adds the private directive.
+	CachePrivate
+	// CacheImmutable adds the immutable directive, for fingerprinted assets.
+	CacheImmutable
+	// CacheNoStore replaces the header with no-store, ignoring maxAge.
+	CacheNoStore
+	// CacheOverride replaces a Cache-Control header that was set by previous middleware.
+	CacheOverride
+)
+
+// CacheControl returns middleware that sets the Cache-Control header.
+// If a Cache-Control header has already been set, it is left alone unless CacheOverride is given.
+// Handlers can still set their own Cache-Control, which will replace this one.
+func CacheControl(maxAge time.Duration, opts ...CacheOption) Middleware {
+	var directives []string
+	override := false
+	noStore := false
+	for _, opt := range opts {
+		switch opt {
+		case CachePublic:
+			directives = append(directives, "public")
+		case CachePrivate:
+			directives = append(directives, "private")
+		case CacheImmutable:
+			directives = append(directives, "immutable")
+		case CacheNoStore:
+			noStore = true
+		case CacheOverride:
+			override = true
+		}
+	}
+
+	value := "no-store"
+	if !noStore {
+		age := "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+		value = strings.Join(append([]string{age}, directives...), ", ")
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if override || w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", value)
+		}
+		return ctx
+	}
+}
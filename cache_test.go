@@ -0,0 +1,46 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestCacheControl(t *testing.T) {
+	kami.Reset()
+	kami.Use("/assets/", kami.CacheControl(365*24*time.Hour, kami.CachePublic, kami.CacheImmutable))
+	kami.Use("/private/", kami.CacheControl(time.Minute, kami.CachePrivate))
+	kami.Use("/private/", kami.CacheControl(0, kami.CacheNoStore))
+	kami.Use("/secret/", kami.CacheControl(time.Minute, kami.CachePrivate))
+	kami.Use("/secret/", kami.CacheControl(0, kami.CacheNoStore, kami.CacheOverride))
+	kami.Get("/assets/app.js", noop)
+	kami.Get("/assets/custom.js", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+	})
+	kami.Get("/private/me", noop)
+	kami.Get("/secret/me", noop)
+
+	expect := map[string]string{
+		"/assets/app.js":    "max-age=31536000, public, immutable",
+		"/assets/custom.js": "no-cache",
+		"/private/me":       "max-age=60, private",
+		"/secret/me":        "no-store",
+	}
+	for path, want := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if got := resp.Header().Get("Cache-Control"); got != want {
+			t.Error("unexpected Cache-Control for", path, got, "≠", want)
+		}
+	}
+}
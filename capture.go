@@ -0,0 +1,63 @@
+package kami
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// CaptureBody returns middleware that keeps a copy of the response body as it is sent,
+// so afterware can read it with ResponseBody. Writes still go straight to the client.
+// At most maxBytes are kept; past that, the copy is marked as truncated. A negative maxBytes counts as 0.
+// With Compress, register CaptureBody after Compress to capture the uncompressed body, or before it for the compressed one.
+func CaptureBody(maxBytes int64) Middleware {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		req := requestFrom(ctx)
+		if req == nil {
+			return ctx
+		}
+		cw := &captureWriter{ResponseWriter: w, max: maxBytes}
+		req.captured = cw
+		SetWriter(ctx, cw)
+		return ctx
+	}
+}
+
+// ResponseBody returns the response body captured by CaptureBody,
+// and whether it was cut off because it was too big.
+// It returns nil if the body isn't being captured.
+func ResponseBody(ctx context.Context) (body []byte, truncated bool) {
+	req := requestFrom(ctx)
+	if req == nil || req.captured == nil {
+		return nil, false
+	}
+	return req.captured.buf, req.captured.truncated
+}
+
+// captureWriter copies up to max bytes of the response.
+type captureWriter struct {
+	http.ResponseWriter
+	max       int64
+	buf       []byte
+	truncated bool
+}
+
+func (cw *captureWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	if room := cw.max - int64(len(cw.buf)); int64(n) > room {
+		cw.buf = append(cw.buf, p[:room]...)
+		cw.truncated = true
+	} else {
+		cw.buf = append(cw.buf, p[:n]...)
+	}
+	return n, err
+}
+
+func (cw *captureWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
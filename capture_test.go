@@ -0,0 +1,79 @@
+package kami_test
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestCaptureBody(t *testing.T) {
+	kami.Reset()
+	var body string
+	var truncated bool
+	kami.After("/", func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+		data, cut := kami.ResponseBody(ctx)
+		body, truncated = string(data), cut
+		return ctx
+	})
+	kami.Get("/short", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello ")
+		io.WriteString(w, "world")
+	}, kami.CaptureBody(16))
+	kami.Get("/long", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("a", 10))
+		io.WriteString(w, strings.Repeat("b", 10))
+	}, kami.CaptureBody(16))
+	kami.Get("/none", noop)
+	kami.Get("/negative", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}, kami.CaptureBody(-1))
+	kami.Get("/gzip", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("z", 100))
+	}, kami.Compress(kami.CompressMinSize(1)), kami.CaptureBody(1000))
+
+	expect := []struct {
+		path      string
+		body      string
+		truncated bool
+	}{
+		{"/short", "hello world", false},
+		{"/long", strings.Repeat("a", 10) + strings.Repeat("b", 6), true},
+		{"/none", "", false},
+		{"/negative", "", true},
+		{"/gzip", strings.Repeat("z", 100), false},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		kami.Handler().ServeHTTP(resp, req)
+		if body != e.body || truncated != e.truncated {
+			t.Error("unexpected capture for", e.path, body, truncated, "≠", e.body, e.truncated)
+		}
+		if e.path == "/long" && resp.Body.Len() != 20 {
+			t.Error("the whole body should still be sent:", resp.Body.String())
+		}
+		if e.path == "/gzip" {
+			zr, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := ioutil.ReadAll(zr); string(data) != e.body {
+				t.Error("unexpected body:", string(data))
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package kami
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Charset returns middleware that makes sure text responses say what charset they're in.
+// When the headers are sent, a text/* Content-Type without a charset parameter gets "; charset=" + def added,
+// so a handler that sets "text/html" sends "text/html; charset=utf-8". Content types with a charset are left alone.
+// Requests with an Accept-Charset header that doesn't allow def are rejected with 406 Not Acceptable.
+// If def is blank, it's utf-8.
+func Charset(def string) Middleware {
+	if def == "" {
+		def = "utf-8"
+	}
+	def = strings.ToLower(def)
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if header := r.Header.Get("Accept-Charset"); header != "" && !accepts(header, def) {
+			ClientError(ctx, w, http.StatusNotAcceptable, "unsupported charset, only "+def+" is available")
+			return nil
+		}
+		SetWriter(ctx, &charsetWriter{ResponseWriter: w, charset: def})
+		return ctx
+	}
+}
+
+// charsetWriter adds the charset to the Content-Type before the headers are written.
+// It has to be a writer and not afterware, since afterware runs after the headers are sent.
+type charsetWriter struct {
+	http.ResponseWriter
+	charset string
+	checked bool
+}
+
+func (cw *charsetWriter) check() {
+	if cw.checked {
+		return
+	}
+	cw.checked = true
+	h := cw.ResponseWriter.Header()
+	ct := h.Get("Content-Type")
+	lower := strings.ToLower(ct)
+	if strings.HasPrefix(lower, "text/") && !strings.Contains(lower, "charset=") {
+		h.Set("Content-Type", strings.TrimRight(ct, "; ")+"; charset="+cw.charset)
+	}
+}
+
+func (cw *charsetWriter) WriteHeader(code int) {
+	cw.check()
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *charsetWriter) Write(p []byte) (int, error) {
+	cw.check()
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *charsetWriter) Flush() {
+	cw.check()
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close fixes the Content-Type of responses that were never written to.
+func (cw *charsetWriter) Close() error {
+	cw.check()
+	return nil
+}
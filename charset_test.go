@@ -0,0 +1,77 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestCharset(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.Charset(""))
+	contentType := func(ct string) kami.HandleFn {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", ct)
+			io.WriteString(w, "hello")
+		}
+	}
+	kami.Get("/html", contentType("text/html"))
+	kami.Get("/latin", contentType("text/plain; charset=ISO-8859-1"))
+	kami.Get("/json", contentType("application/json"))
+	kami.Get("/css", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+	})
+
+	tests := []struct {
+		path, acceptCharset string
+		code                int
+		contentType         string
+	}{
+		{"/html", "", http.StatusOK, "text/html; charset=utf-8"},
+		{"/latin", "", http.StatusOK, "text/plain; charset=ISO-8859-1"},
+		{"/json", "", http.StatusOK, "application/json"},
+		{"/css", "", http.StatusOK, "text/css; charset=utf-8"},
+		{"/html", "iso-8859-1, UTF-8;q=0.7", http.StatusOK, "text/html; charset=utf-8"},
+		{"/html", "*", http.StatusOK, "text/html; charset=utf-8"},
+		{"/html", "iso-8859-1", http.StatusNotAcceptable, ""},
+		{"/html", "utf-8;q=0, *;q=0", http.StatusNotAcceptable, ""},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.acceptCharset != "" {
+			req.Header.Set("Accept-Charset", test.acceptCharset)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Error("unexpected status for", test.path, test.acceptCharset, resp.Code, "≠", test.code)
+		}
+		if test.contentType != "" && resp.Header().Get("Content-Type") != test.contentType {
+			t.Error("unexpected Content-Type for", test.path, test.acceptCharset, resp.Header().Get("Content-Type"), "≠", test.contentType)
+		}
+	}
+
+	// other charsets
+	kami.Reset()
+	kami.Use("/", kami.Charset("Shift_JIS"))
+	kami.Get("/html", contentType("text/html"))
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Charset", "shift_jis")
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "text/html; charset=shift_jis" {
+		t.Error("unexpected response for Shift_JIS", resp.Code, resp.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,68 @@
+package kami
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// CleanMode is how CleanPath handles unclean paths.
+type CleanMode int
+
+const (
+	// CleanRewrite routes the request as if the clean path had been requested.
+	CleanRewrite CleanMode = iota
+	// CleanRedirect redirects to the clean path, with 301 Moved Permanently for GET and HEAD,
+	// and 308 Permanent Redirect for other methods.
+	CleanRedirect
+)
+
+// CleanPath wraps h (usually kami.Handler()) to clean up request paths before routing,
+// collapsing repeated slashes and resolving . and .. segments like path.Clean.
+// A trailing slash is kept, so httprouter can still redirect it as usual.
+// Encoded slashes (%2F) are part of a segment, so they're left alone.
+// httprouter already redirects some unclean paths that match a route (see httprouter.Router.RedirectFixedPath),
+// but CleanPath handles every request, including ones for NotFound and fallbacks, and can rewrite instead of redirecting.
+func CleanPath(h http.Handler, mode CleanMode) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		escaped := r.URL.EscapedPath()
+		clean := cleanPath(escaped)
+		if clean == escaped {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if mode == CleanRedirect {
+			u := *r.URL
+			u.RawPath = clean
+			u.Path, _ = url.PathUnescape(clean)
+			code := http.StatusPermanentRedirect
+			if r.Method == "GET" || r.Method == "HEAD" {
+				code = http.StatusMovedPermanently
+			}
+			http.Redirect(w, r, u.RequestURI(), code)
+			return
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path, _ = url.PathUnescape(clean)
+		u.RawPath = clean
+		r2.URL = &u
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// cleanPath cleans an escaped path, keeping a trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
@@ -0,0 +1,64 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestCleanPath(t *testing.T) {
+	kami.Reset()
+	kami.Get("/a/b", noop)
+	kami.Get("/files/*name", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.EscapedPath())
+	})
+
+	// rewriting
+	rewrite := kami.CleanPath(kami.Handler(), kami.CleanRewrite)
+	for _, path := range []string{"/a/b", "//a//b", "/a/../a/./b", "/x/../a/b"} {
+		resp := httptest.NewRecorder()
+		// NewRequest would parse //a as a host
+		req := httptest.NewRequest("GET", path, nil)
+		rewrite.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Error("should return HTTP StatusOK(200) for", path, resp.Code, "≠", http.StatusOK)
+		}
+	}
+
+	// encoded slashes stay put
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "//files/a%2F%2Fb", nil)
+	rewrite.ServeHTTP(resp, req)
+	if body := resp.Body.String(); body != "/files/a%2F%2Fb" {
+		t.Error("encoded slashes shouldn't be collapsed:", body)
+	}
+
+	// redirecting
+	redirect := kami.CleanPath(kami.Handler(), kami.CleanRedirect)
+	expect := []struct {
+		method, path string
+		status       int
+		location     string
+	}{
+		{"GET", "/a/b", http.StatusOK, ""},
+		{"GET", "//a//b?x=1", http.StatusMovedPermanently, "/a/b?x=1"},
+		{"POST", "/a/./b", http.StatusPermanentRedirect, "/a/b"},
+		{"GET", "/a/../c/", http.StatusMovedPermanently, "/c/"},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(e.method, e.path, nil)
+		redirect.ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.path, resp.Code, "≠", e.status)
+		}
+		if got := resp.Header().Get("Location"); got != e.location {
+			t.Error("unexpected location for", e.path, got, "≠", e.location)
+		}
+	}
+}
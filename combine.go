@@ -0,0 +1,71 @@
+package kami
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Combine returns a handler that sends each request to the handler mounted at the longest prefix of its path,
+// with the prefix stripped, so a request for /api/users with a handler mounted at "/api" is served as /users.
+// A prefix matches whole path segments: "/api" matches /api and /api/users, but not /apiary.
+// The handler mounted at "" or "/" gets requests that don't match any other prefix, unstripped.
+// Without one, they get the NotFound handler.
+// Mounted handlers are independent: each one's middleware only sees the requests sent to it.
+func Combine(handlers map[string]http.Handler) http.Handler {
+	type mount struct {
+		prefix  string
+		handler http.Handler
+	}
+	var mounts []mount
+	var def http.Handler
+	for prefix, h := range handlers {
+		prefix = strings.TrimRight(prefix, "/")
+		if prefix == "" {
+			def = h
+			continue
+		}
+		mounts = append(mounts, mount{prefix, h})
+	}
+	// longest first, so the most specific prefix wins
+	sort.Slice(mounts, func(i, j int) bool {
+		return len(mounts[i].prefix) > len(mounts[j].prefix)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range mounts {
+			rest := strings.TrimPrefix(r.URL.Path, m.prefix)
+			if len(rest) == len(r.URL.Path) || (rest != "" && rest[0] != '/') {
+				continue
+			}
+			m.handler.ServeHTTP(w, stripPrefix(r, m.prefix, rest))
+			return
+		}
+		if def != nil {
+			def.ServeHTTP(w, r)
+			return
+		}
+		notFound(w, r, nil)
+	})
+}
+
+// stripPrefix returns a copy of r with prefix removed from its path, leaving rest.
+func stripPrefix(r *http.Request, prefix, rest string) *http.Request {
+	if rest == "" {
+		rest = "/"
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = rest
+	if r.URL.RawPath != "" {
+		r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+		if r2.URL.RawPath == "" || r2.URL.RawPath[0] != '/' {
+			// the prefix was escaped differently, so let net/url work it out
+			r2.URL.RawPath = ""
+		}
+	}
+	return r2
+}
@@ -0,0 +1,91 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestCombine(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		w.Header().Set("X-Kami", "1")
+		return ctx
+	})
+	kami.Get("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "api users")
+	})
+
+	admin := http.NewServeMux()
+	admin.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "admin "+r.URL.Path)
+	})
+	adminOnly := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Admin", "1")
+			h.ServeHTTP(w, r)
+		})
+	}
+	v2 := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "v2 "+r.URL.Path)
+	})
+	site := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "site "+r.URL.Path)
+	})
+
+	h := kami.Combine(map[string]http.Handler{
+		"/api":    kami.Handler(),
+		"/api/v2": v2,
+		"/admin/": adminOnly(admin),
+		"":        site,
+	})
+
+	tests := []struct {
+		path        string
+		body        string
+		kami, admin bool
+	}{
+		{"/api/users", "api users", true, false},
+		{"/api/v2/users", "v2 /users", false, false},
+		{"/api/v2", "v2 /", false, false},
+		{"/admin", "admin /", false, true},
+		{"/admin/settings", "admin /settings", false, true},
+		{"/administrator", "site /administrator", false, false},
+		{"/", "site /", false, false},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h.ServeHTTP(resp, req)
+		if resp.Body.String() != test.body {
+			t.Errorf("unexpected body for %s: %q ≠ %q", test.path, resp.Body.String(), test.body)
+		}
+		if (resp.Header().Get("X-Kami") != "") != test.kami {
+			t.Error("kami middleware should only run for its own requests", test.path)
+		}
+		if (resp.Header().Get("X-Admin") != "") != test.admin {
+			t.Error("admin middleware should only run for its own requests", test.path)
+		}
+	}
+
+	// no default
+	h = kami.Combine(map[string]http.Handler{"/api": kami.Handler()})
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/elsewhere", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Error("unmatched requests should get NotFound", resp.Code)
+	}
+}
@@ -0,0 +1,192 @@
+package kami
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// CompressOption configures Compress.
+type CompressOption func(*compressConfig)
+
+type compressConfig struct {
+	minSize int
+	level   int
+}
+
+// CompressMinSize sets how many bytes of a response are buffered before deciding to compress it.
+// Responses smaller than this are sent uncompressed. The default is 1024.
+func CompressMinSize(n int) CompressOption {
+	return func(cfg *compressConfig) {
+		cfg.minSize = n
+	}
+}
+
+// CompressLevel sets the gzip compression level. The default is gzip.DefaultCompression.
+func CompressLevel(level int) CompressOption {
+	return func(cfg *compressConfig) {
+		cfg.level = level
+	}
+}
+
+// Compress returns middleware that gzips responses for clients that accept it.
+// Output is buffered until it reaches the minimum size, so small responses aren't compressed.
+// Content-Encoding and Vary are only set if the response is compressed.
+// Responses that already have a Content-Encoding are left alone.
+// Flushing sends whatever is buffered, compressing it only if it has reached the minimum size.
+func Compress(opts ...CompressOption) Middleware {
+	cfg := compressConfig{
+		minSize: 1024,
+		level:   gzip.DefaultCompression,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if r.Method == "HEAD" || !acceptsEncoding(r, "gzip") {
+			return ctx
+		}
+		SetWriter(ctx, &compressWriter{ResponseWriter: w, cfg: cfg})
+		return ctx
+	}
+}
+
+// acceptsEncoding returns true if the request's Accept-Encoding allows the given content coding, like gzip.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	return accepts(r.Header.Get("Accept-Encoding"), encoding)
+}
+
+// accepts reports whether an Accept-Encoding or Accept-Charset style header value allows token,
+// either by name or with *, and without q=0.
+func accepts(header, token string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name != token && name != "*" {
+			continue
+		}
+		rejected := false
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				rejected = err == nil && q == 0
+			}
+		}
+		if !rejected {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response to decide whether to gzip it.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg     compressConfig
+	buf     []byte
+	status  int
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	// informational responses like 103 Early Hints come before the real one
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	cw.status = code
+	// these can't have a body
+	if code == http.StatusNoContent || code == http.StatusNotModified || code < 200 {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.cfg.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide sends the header and anything buffered, gzipping it if compress is true.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	h := cw.ResponseWriter.Header()
+	// gzipping part of a response would make its Content-Range wrong
+	if cw.status == http.StatusPartialContent || h.Get("Content-Range") != "" {
+		compress = false
+	}
+	if compress && h.Get("Content-Encoding") == "" {
+		// net/http doesn't sniff the Content-Type of encoded responses, so do it here
+		if _, ok := h["Content-Type"]; !ok && len(cw.buf) > 0 {
+			h.Set("Content-Type", http.DetectContentType(cw.buf))
+		}
+		h.Set("Content-Encoding", "gzip")
+		h.Add("Vary", "Accept-Encoding")
+		h.Del("Content-Length")
+		cw.gz, _ = gzip.NewWriterLevel(cw.ResponseWriter, cw.cfg.level)
+	}
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.gz != nil {
+		_, err = cw.gz.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(len(cw.buf) >= cw.cfg.minSize)
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends a response that never reached the minimum size uncompressed, and finishes the gzip stream.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.gz != nil {
+		return cw.gz.Close()
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package kami_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestCompress(t *testing.T) {
+	kami.Reset()
+	var sent int
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		sent = w.BytesWritten()
+	}
+	kami.Use("/", kami.Compress(kami.CompressMinSize(100)))
+	big := strings.Repeat("kami ", 100)
+	kami.Get("/small", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("tiny"))
+	})
+	kami.Get("/big", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(big[:50]))
+		w.Write([]byte(big[50:]))
+	})
+
+	// small responses pass through
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/small", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusCreated {
+		t.Error("should return HTTP StatusCreated(201)", resp.Code, "≠", http.StatusCreated)
+	}
+	if resp.Header().Get("Content-Encoding") != "" || resp.Header().Get("Vary") != "" {
+		t.Error("small responses shouldn't be compressed:", resp.Header())
+	}
+	if body := resp.Body.String(); body != "tiny" {
+		t.Error("unexpected body:", body)
+	}
+
+	// big ones are gzipped
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/big", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+	}
+	if resp.Header().Get("Content-Encoding") != "gzip" || resp.Header().Get("Vary") != "Accept-Encoding" {
+		t.Error("big responses should be compressed:", resp.Header())
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Error("compressed responses should have their Content-Type sniffed:", ct)
+	}
+	if sent != resp.Body.Len() {
+		t.Error("log handler should see the compressed size", sent, "≠", resp.Body.Len())
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != big {
+		t.Error("unexpected body:", string(data))
+	}
+
+	// clients that don't accept gzip get it uncompressed
+	for _, accept := range []string{"", "deflate", "gzip;q=0"} {
+		resp = httptest.NewRecorder()
+		req.Header.Set("Accept-Encoding", accept)
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Header().Get("Content-Encoding") != "" {
+			t.Error("shouldn't compress for Accept-Encoding", accept)
+		}
+		if resp.Body.String() != big {
+			t.Error("unexpected body for Accept-Encoding", accept)
+		}
+	}
+}
+
+func TestCompressPartial(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.Compress())
+	content := strings.Repeat("0123456789", 1000)
+	kami.Get("/file", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		kami.ServeContentRange(ctx, w, r, strings.NewReader(content), time.Time{})
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/file", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-4999")
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusPartialContent {
+		t.Error("should return HTTP StatusPartialContent(206)", resp.Code, "≠", http.StatusPartialContent)
+	}
+	if resp.Header().Get("Content-Encoding") != "" {
+		t.Error("partial responses shouldn't be compressed")
+	}
+	if resp.Header().Get("Content-Length") != "5000" || resp.Body.String() != content[:5000] {
+		t.Error("unexpected partial response", resp.Header().Get("Content-Length"), resp.Body.Len())
+	}
+}
+
+func TestCompressEarlyHints(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.Compress())
+	kami.Get("/hints", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(strings.Repeat("kami ", 1000)))
+	})
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL+"/hints", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Error("should return HTTP StatusCreated(201) after early hints", resp.StatusCode, "≠", http.StatusCreated)
+	}
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Error("the final response should still be compressed")
+	}
+}
@@ -0,0 +1,110 @@
+package kami
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ConditionalRequests returns middleware that answers conditional GET and HEAD requests
+// (If-None-Match and If-Modified-Since) with 304 Not Modified,
+// using the ETag and Last-Modified headers set by the handler.
+// It checks when the handler sends its response headers, so validators must be set before the first write.
+// Only 200 OK responses are changed; the body of a 304 response is thrown away.
+func ConditionalRequests() Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			return ctx
+		}
+		if r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "" {
+			return ctx
+		}
+		SetWriter(ctx, &conditionalWriter{ResponseWriter: w, r: r})
+		return ctx
+	}
+}
+
+// conditionalWriter turns a 200 into a 304 if the request's validators match.
+type conditionalWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+	suppress    bool
+}
+
+func (cw *conditionalWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	if code == http.StatusOK && notModified(cw.r, cw.Header()) {
+		cw.suppress = true
+		h := cw.Header()
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		h.Del("Content-Encoding")
+		if h.Get("ETag") != "" {
+			h.Del("Last-Modified")
+		}
+		code = http.StatusNotModified
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *conditionalWriter) Write(p []byte) (int, error) {
+	cw.WriteHeader(http.StatusOK)
+	if cw.suppress {
+		return len(p), nil
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *conditionalWriter) Flush() {
+	cw.WriteHeader(http.StatusOK)
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok && !cw.suppress {
+		f.Flush()
+	}
+}
+
+// Close sends the 304 for handlers that set validators but didn't write anything.
+func (cw *conditionalWriter) Close() error {
+	if !cw.wroteHeader && notModified(cw.r, cw.Header()) {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return nil
+}
+
+// notModified reports whether the response described by h matches the request's conditional headers.
+// If-Modified-Since is ignored when If-None-Match is given, as per RFC 7232.
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakETag(candidate) == weakETag(etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(ims)
+}
+
+// weakETag strips the weak prefix, for weak comparison.
+func weakETag(etag string) string {
+	return strings.TrimPrefix(etag, "W/")
+}
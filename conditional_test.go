@@ -0,0 +1,73 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	kami.Reset()
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	kami.Use("/", kami.ConditionalRequests())
+	kami.Get("/etag", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	})
+	kami.Get("/modified", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		w.Write([]byte("hello"))
+	})
+	kami.Get("/empty", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+	})
+	kami.Get("/created", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+
+	expect := []struct {
+		path, header, value string
+		status              int
+		body                string
+	}{
+		{"/etag", "If-None-Match", `"v1"`, http.StatusNotModified, ""},
+		{"/etag", "If-None-Match", `"v0", W/"v1"`, http.StatusNotModified, ""},
+		{"/etag", "If-None-Match", "*", http.StatusNotModified, ""},
+		{"/etag", "If-None-Match", `"v2"`, http.StatusOK, "hello"},
+		{"/etag", "", "", http.StatusOK, "hello"},
+		{"/modified", "If-Modified-Since", modified.Format(http.TimeFormat), http.StatusNotModified, ""},
+		{"/modified", "If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, "hello"},
+		{"/modified", "If-Modified-Since", "garbage", http.StatusOK, "hello"},
+		{"/empty", "If-None-Match", `"v1"`, http.StatusNotModified, ""},
+		{"/created", "If-None-Match", `"v1"`, http.StatusCreated, "hello"},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.header != "" {
+			req.Header.Set(e.header, e.value)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.path, e.header, e.value, resp.Code, "≠", e.status)
+		}
+		if resp.Body.String() != e.body {
+			t.Error("unexpected body for", e.path, e.header, e.value, resp.Body.String(), "≠", e.body)
+		}
+		if e.status == http.StatusNotModified && resp.Header().Get("Content-Type") != "" {
+			t.Error("304 shouldn't have a Content-Type")
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package kami
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// RequireContentType returns middleware that rejects requests whose Content-Type isn't one of types
+// with 415 Unsupported Media Type. Parameters like charset are ignored.
+// POST, PUT, and PATCH requests are always checked, other methods only if they have a body.
+func RequireContentType(types ...string) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if !hasBody(r) || contentTypeIs(r, types) {
+			return ctx
+		}
+		ClientError(ctx, w, http.StatusUnsupportedMediaType, "Content-Type must be "+strings.Join(types, " or "))
+		return nil
+	}
+}
+
+// hasBody reports whether r is expected to have a body.
+func hasBody(r *http.Request) bool {
+	switch r.Method {
+	case "POST", "PUT", "PATCH":
+		return true
+	}
+	return r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody
+}
+
+// contentTypeIs reports whether the media type of r is one of types.
+func contentTypeIs(r *http.Request, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// WhenContentType returns middleware that runs mw only for requests whose Content-Type is one of types,
+// and does nothing for other requests. Parameters like charset are ignored, like RequireContentType.
+// This is for middleware that transforms certain kinds of bodies, such as decrypting an encrypted payload.
+func WhenContentType(types []string, mw Middleware) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if !contentTypeIs(r, types) {
+			return ctx
+		}
+		return mw(ctx, w, r)
+	}
+}
@@ -0,0 +1,89 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestRequireContentType(t *testing.T) {
+	kami.Reset()
+	kami.Use("/api/", kami.RequireContentType("application/json"))
+	kami.Get("/api/thing", noop)
+	kami.Head("/api/thing", noop)
+	kami.Post("/api/thing", noop)
+	kami.Put("/api/thing", noop)
+	kami.Delete("/api/thing", noop)
+
+	tests := []struct {
+		method      string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"GET", "", "", http.StatusOK},
+		{"HEAD", "", "", http.StatusOK},
+		{"DELETE", "", "", http.StatusOK},
+		{"POST", "application/json", "{}", http.StatusOK},
+		{"POST", "application/json; charset=utf-8", "{}", http.StatusOK},
+		{"PUT", "Application/JSON", "{}", http.StatusOK},
+		{"POST", "", "{}", http.StatusUnsupportedMediaType},
+		{"POST", "text/plain", "{}", http.StatusUnsupportedMediaType},
+		{"PUT", "application/x-www-form-urlencoded", "a=b", http.StatusUnsupportedMediaType},
+		{"DELETE", "text/plain", "hello", http.StatusUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(test.method, "/api/thing", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Error("unexpected status for", test.method, test.contentType, resp.Code, "≠", test.code)
+		}
+	}
+}
+
+func TestWhenContentType(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.WhenContentType([]string{"application/x-encrypted"}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		w.Header().Set("X-Decrypted", "yes")
+		return ctx
+	}))
+	kami.Post("/", noop)
+
+	expect := map[string]string{
+		"application/x-encrypted":                "yes",
+		"Application/X-Encrypted; charset=utf-8": "yes",
+		"application/json":                       "",
+		"":                                       "",
+	}
+	for ct, want := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/", strings.NewReader("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct != "" {
+			req.Header.Set("Content-Type", ct)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if got := resp.Header().Get("X-Decrypted"); got != want {
+			t.Error("unexpected result for", ct, got, "≠", want)
+		}
+		if resp.Code != http.StatusOK {
+			t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package kami
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// CookieSigner signs and verifies cookies with HMAC-SHA256, so clients can read but not change them.
+type CookieSigner struct {
+	secrets [][]byte
+}
+
+// SignedCookie returns a CookieSigner using the given secrets.
+// Cookies are signed with the first secret, and verified against all of them,
+// so a new secret can be put first while cookies signed with older ones are still accepted.
+func SignedCookie(secrets ...[]byte) *CookieSigner {
+	if len(secrets) == 0 {
+		panic("kami: SignedCookie needs at least one secret")
+	}
+	return &CookieSigner{secrets: secrets}
+}
+
+// SetSigned sets cookie on the response with a signature added to its value.
+// The cookie itself isn't modified.
+func (s *CookieSigner) SetSigned(w http.ResponseWriter, cookie *http.Cookie) {
+	signed := *cookie
+	signed.Value = base64.RawURLEncoding.EncodeToString([]byte(cookie.Value)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.sign(s.secrets[0], cookie.Name, cookie.Value))
+	http.SetCookie(w, &signed)
+}
+
+// GetSigned returns the value of the named cookie, if it is present and its signature is valid.
+func (s *CookieSigner) GetSigned(r *http.Request, name string) (value string, ok bool) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndex(cookie.Value, ".")
+	if i == -1 {
+		return "", false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value[:i])
+	if err != nil {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(cookie.Value[i+1:])
+	if err != nil {
+		return "", false
+	}
+
+	value = string(data)
+	for _, secret := range s.secrets {
+		if hmac.Equal(sig, s.sign(secret, name, value)) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// sign signs the name too, so a signed value can't be moved to another cookie.
+func (s *CookieSigner) sign(secret []byte, name, value string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,64 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/guregu/kami"
+)
+
+func TestSignedCookie(t *testing.T) {
+	oldSigner := kami.SignedCookie([]byte("old secret"))
+	signer := kami.SignedCookie([]byte("new secret"), []byte("old secret"))
+
+	// returns the signed cookie's value as sent by signer
+	sign := func(signer *kami.CookieSigner, cookie *http.Cookie) string {
+		resp := httptest.NewRecorder()
+		signer.SetSigned(resp, cookie)
+		return resp.Result().Cookies()[0].Value
+	}
+	get := func(name, value string) (string, bool) {
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+		return signer.GetSigned(req, name)
+	}
+
+	cookie := &http.Cookie{Name: "user", Value: "42; admin=no"}
+	signed := sign(signer, cookie)
+	if cookie.Value != "42; admin=no" {
+		t.Error("cookie shouldn't be modified:", cookie.Value)
+	}
+	if v, ok := get("user", signed); !ok || v != "42; admin=no" {
+		t.Error("should verify a signed cookie:", v, ok)
+	}
+
+	// rotated secrets are still accepted
+	if v, ok := get("user", sign(oldSigner, cookie)); !ok || v != "42; admin=no" {
+		t.Error("should verify cookies signed with an old secret:", v, ok)
+	}
+
+	// tampering
+	forged := sign(kami.SignedCookie([]byte("wrong")), cookie)
+	tampered := []struct{ name, value string }{
+		{"user", forged},
+		{"user", "NDM." + signed[len("NDI7IGFkbWluPW5v."):]},
+		{"other", signed},
+		{"user", "42"},
+		{"user", ""},
+	}
+	for _, c := range tampered {
+		if v, ok := get(c.name, c.value); ok {
+			t.Error("should reject tampered cookie", c.name, c.value, v)
+		}
+	}
+
+	// missing
+	req, _ := http.NewRequest("GET", "/", nil)
+	if _, ok := signer.GetSigned(req, "user"); ok {
+		t.Error("should reject a missing cookie")
+	}
+}
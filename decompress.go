@@ -0,0 +1,82 @@
+package kami
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// DecompressOption configures DecompressRequest.
+type DecompressOption func(*decompressor)
+
+// DecompressMaxSize sets the largest decompressed request body that DecompressRequest will accept.
+// Bigger bodies are rejected with 413 Request Entity Too Large. The default is 10MB.
+func DecompressMaxSize(n int64) DecompressOption {
+	return func(d *decompressor) {
+		d.maxSize = n
+	}
+}
+
+type decompressor struct {
+	maxSize int64
+}
+
+// DecompressRequest returns middleware that decompresses request bodies sent with Content-Encoding: gzip or deflate,
+// so the handler and helpers like BindJSON see plain data.
+// The body is decompressed up front, and the Content-Encoding header is removed and Content-Length updated.
+// To guard against zip bombs, bodies that decompress to more than the maximum size get 413 Request Entity Too Large,
+// and corrupt bodies get 400 Bad Request. Other encodings get 415 Unsupported Media Type.
+// The responses are written by ClientError.
+func DecompressRequest(opts ...DecompressOption) Middleware {
+	d := &decompressor{maxSize: 10 << 20}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+			return ctx
+		}
+
+		var zr io.ReadCloser
+		var err error
+		switch encoding {
+		case "gzip", "x-gzip":
+			zr, err = gzip.NewReader(r.Body)
+		case "deflate":
+			zr, err = zlib.NewReader(r.Body)
+		default:
+			ClientError(ctx, w, http.StatusUnsupportedMediaType, "unsupported Content-Encoding: "+encoding)
+			return nil
+		}
+		if err != nil {
+			ClientError(ctx, w, http.StatusBadRequest, "can't decompress request body")
+			return nil
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(zr, d.maxSize+1))
+		zr.Close()
+		r.Body.Close()
+		if err != nil {
+			ClientError(ctx, w, http.StatusBadRequest, "can't decompress request body")
+			return nil
+		}
+		if int64(len(data)) > d.maxSize {
+			ClientError(ctx, w, http.StatusRequestEntityTooLarge, "decompressed request body is too large")
+			return nil
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(data))
+		r.ContentLength = int64(len(data))
+		r.Header.Del("Content-Encoding")
+		r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+		return ctx
+	}
+}
@@ -0,0 +1,78 @@
+package kami_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestDecompressRequest(t *testing.T) {
+	compress := func(encoding, s string) []byte {
+		var buf bytes.Buffer
+		var zw io.WriteCloser
+		if encoding == "deflate" {
+			zw = zlib.NewWriter(&buf)
+		} else {
+			zw = gzip.NewWriter(&buf)
+		}
+		io.WriteString(zw, s)
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	kami.Reset()
+	kami.Post("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var user struct {
+			Name string `json:"name"`
+		}
+		if err := kami.BindJSON(r, &user); err != nil {
+			t.Error(err)
+		}
+		if enc := r.Header.Get("Content-Encoding"); enc != "" {
+			t.Error("Content-Encoding should be removed, got", enc)
+		}
+		io.WriteString(w, user.Name)
+	}, kami.DecompressRequest(kami.DecompressMaxSize(64)))
+
+	const user = `{"name": "Ichigo"}`
+	expect := []struct {
+		encoding string
+		body     []byte
+		status   int
+		name     string
+	}{
+		{"", []byte(user), http.StatusOK, "Ichigo"},
+		{"gzip", compress("gzip", user), http.StatusOK, "Ichigo"},
+		{"deflate", compress("deflate", user), http.StatusOK, "Ichigo"},
+		{"gzip", []byte("not gzip"), http.StatusBadRequest, ""},
+		{"gzip", compress("gzip", `{"name": "`+strings.Repeat("a", 100)+`"}`), http.StatusRequestEntityTooLarge, ""},
+		{"br", []byte(user), http.StatusUnsupportedMediaType, ""},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/users", bytes.NewReader(e.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.encoding != "" {
+			req.Header.Set("Content-Encoding", e.encoding)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.encoding, resp.Code, "≠", e.status)
+		}
+		if e.status == http.StatusOK && resp.Body.String() != e.name {
+			t.Error("handler should see the decompressed body:", resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package kami
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
+)
+
+// DumpOutput is where DumpRequest writes requests.
+// Set it to nil to disable dumping entirely, for example in production.
+var DumpOutput io.Writer = os.Stderr
+
+// DumpRequest returns middleware that writes each request, with its URL parameters, to DumpOutput.
+// If includeBody is true, the body is included too. It will be buffered so the handler can still read it.
+func DumpRequest(includeBody bool) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		out := DumpOutput
+		if out == nil {
+			return ctx
+		}
+
+		var body []byte
+		var bodyErr error
+		if includeBody {
+			body, bodyErr = BufferBody(r)
+		}
+		dump, err := httputil.DumpRequest(r, false)
+		if err != nil {
+			fmt.Fprintf(out, "kami: couldn't dump request %s %s: %v\n", r.Method, r.URL, err)
+			return ctx
+		}
+
+		var buf bytes.Buffer
+		buf.Write(dump)
+		buf.Write(body)
+		if bodyErr != nil {
+			fmt.Fprintf(&buf, "\n(error reading body: %v)", bodyErr)
+		}
+		if params, ok := ctx.Value(paramsKey).(httprouter.Params); ok {
+			buf.WriteString("\nParams:")
+			for _, p := range params {
+				fmt.Fprintf(&buf, " %s=%q", p.Key, p.Value)
+			}
+		}
+		buf.WriteString("\n\n")
+		// write it all at once so concurrent dumps don't interleave
+		out.Write(buf.Bytes())
+		return ctx
+	}
+}
@@ -0,0 +1,67 @@
+package kami_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestDumpRequest(t *testing.T) {
+	kami.Reset()
+	var out bytes.Buffer
+	defer func(orig io.Writer) {
+		kami.DumpOutput = orig
+	}(kami.DumpOutput)
+	kami.DumpOutput = &out
+
+	kami.Use("/", kami.DumpRequest(true))
+	kami.Post("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/users/42", strings.NewReader(`{"name":"greg"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Test", "dump")
+
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Body.String() != `{"name":"greg"}` {
+		t.Error("handler couldn't read the body:", resp.Body.String())
+	}
+	dump := out.String()
+	for _, want := range []string{"POST /users/42", "X-Test: dump", `{"name":"greg"}`, `id="42"`} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump should contain %q: %s", want, dump)
+		}
+	}
+
+	// disabled
+	out.Reset()
+	kami.DumpOutput = nil
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest("POST", "/users/42", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if out.Len() != 0 {
+		t.Error("nothing should be dumped when disabled:", out.String())
+	}
+	if resp.Body.String() != "hello" {
+		t.Error("unexpected body:", resp.Body.String())
+	}
+}
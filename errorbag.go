@@ -0,0 +1,80 @@
+package kami
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// ErrorBagRenderer writes the response for ErrorBag.Render. It defaults to WriteFieldErrors.
+var ErrorBagRenderer func(w http.ResponseWriter, status int, errs BindErrors) = WriteFieldErrors
+
+// ErrorBag collects field errors over the course of a request, so they can all be returned at once.
+// It's safe to use from multiple goroutines.
+type ErrorBag struct {
+	mu   sync.Mutex
+	errs BindErrors
+}
+
+// Errors returns the current request's ErrorBag, creating it the first time it's asked for.
+// If ctx didn't come from kami, a new, unshared bag is returned every time.
+func Errors(ctx context.Context) *ErrorBag {
+	req := requestFrom(ctx)
+	if req == nil {
+		return new(ErrorBag)
+	}
+	req.errorsOnce.Do(func() {
+		req.errors = new(ErrorBag)
+	})
+	return req.errors
+}
+
+// Add records an error message for the given field.
+func (bag *ErrorBag) Add(field, msg string) {
+	bag.mu.Lock()
+	defer bag.mu.Unlock()
+	bag.errs = append(bag.errs, FieldError{Field: field, Err: errors.New(msg)})
+}
+
+// AddError records err, which can be the BindErrors or FieldError returned by Bind, BindQuery, and so on.
+// Other errors are added without a field. A nil error is ignored, so binding results can be passed straight in:
+//
+//	kami.Errors(ctx).AddError(kami.BindQuery(r, &query))
+func (bag *ErrorBag) AddError(err error) {
+	if err == nil {
+		return
+	}
+	bag.mu.Lock()
+	defer bag.mu.Unlock()
+	var errs BindErrors
+	var fe FieldError
+	switch {
+	case errors.As(err, &errs):
+		bag.errs = append(bag.errs, errs...)
+	case errors.As(err, &fe):
+		bag.errs = append(bag.errs, fe)
+	default:
+		bag.errs = append(bag.errs, FieldError{Err: err})
+	}
+}
+
+// HasErrors returns true if any errors have been added.
+func (bag *ErrorBag) HasErrors() bool {
+	bag.mu.Lock()
+	defer bag.mu.Unlock()
+	return len(bag.errs) > 0
+}
+
+// Errors returns a copy of the errors that have been added.
+func (bag *ErrorBag) Errors() BindErrors {
+	bag.mu.Lock()
+	defer bag.mu.Unlock()
+	return append(BindErrors(nil), bag.errs...)
+}
+
+// Render writes every error with ErrorBagRenderer as a 422 Unprocessable Entity response.
+func (bag *ErrorBag) Render(w http.ResponseWriter) {
+	ErrorBagRenderer(w, http.StatusUnprocessableEntity, bag.Errors())
+}
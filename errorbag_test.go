@@ -0,0 +1,92 @@
+package kami_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestErrors(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		var query struct {
+			Page int `query:"page"`
+		}
+		kami.Errors(ctx).AddError(kami.BindQuery(r, &query))
+		return ctx
+	})
+	kami.Post("/signup", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Email string `json:"email"`
+		}
+		kami.Errors(ctx).AddError(kami.BindJSON(r, &body))
+		if body.Email == "" {
+			kami.Errors(ctx).Add("email", "is required")
+		}
+		if kami.Errors(ctx).HasErrors() {
+			kami.Errors(ctx).Render(w)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	do := func(path, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := do("/signup", `{"email":"a@example.com"}`); resp.Code != http.StatusCreated {
+		t.Error("should return HTTP StatusCreated(201)", resp.Code, "≠", http.StatusCreated)
+	}
+
+	resp := do("/signup?page=x", `{}`)
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Error("should return HTTP StatusUnprocessableEntity(422)", resp.Code, "≠", http.StatusUnprocessableEntity)
+	}
+	var problem struct {
+		Status int
+		Errors []struct {
+			Field  string
+			Source string
+			Error  string
+		}
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Status != 422 || len(problem.Errors) != 2 {
+		t.Fatal("unexpected problem:", resp.Body.String())
+	}
+	if e := problem.Errors[0]; e.Field != "Page" || e.Source != "query" {
+		t.Error("unexpected query error:", e)
+	}
+	if e := problem.Errors[1]; e.Field != "email" || e.Error != "is required" {
+		t.Error("unexpected body error:", e)
+	}
+
+	// bags aren't shared between requests
+	if resp := do("/signup", `{"email":"a@example.com"}`); resp.Code != http.StatusCreated {
+		t.Error("should return HTTP StatusCreated(201)", resp.Code, "≠", http.StatusCreated)
+	}
+
+	// custom rendering
+	kami.ErrorBagRenderer = func(w http.ResponseWriter, status int, errs kami.BindErrors) {
+		w.WriteHeader(status)
+		w.Write([]byte(errs.Error()))
+	}
+	resp = do("/signup", `{}`)
+	if resp.Code != http.StatusUnprocessableEntity || resp.Body.String() != "email: is required" {
+		t.Errorf("unexpected custom response: %d %q", resp.Code, resp.Body.String())
+	}
+}
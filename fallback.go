@@ -0,0 +1,226 @@
+package kami
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
+)
+
+var fallbacks = make(map[string]httprouter.Handle)
+
+// Fallback registers a handler for requests under prefix that don't match any route.
+// For example, with a fallback for "/api/", a request for /api/missing will use the fallback,
+// while /api/users/:id still goes to its own handler.
+// If fallbacks are registered for nested prefixes, the most specific one wins.
+// Requests that don't fall under any fallback get the NotFound handler.
+// Requests for a path that is registered with a different method still get 405 Method Not Allowed.
+// Since they didn't match a route, Matched returns false for requests handled by a fallback.
+func Fallback(prefix string, handle HandleFn) {
+	fallbacks[strings.TrimRight(prefix, "/")+"/"] = bless(handle, false, "", nil, nil, false)
+}
+
+// findFallback returns the fallback for the most specific prefix of path, or nil.
+func findFallback(path string) httprouter.Handle {
+	if len(fallbacks) == 0 {
+		return nil
+	}
+	// /api should use the fallback for /api/
+	if !strings.HasSuffix(path, "/") {
+		if h, ok := fallbacks[path+"/"]; ok {
+			return h
+		}
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' {
+			if h, ok := fallbacks[path[:i+1]]; ok {
+				return h
+			}
+		}
+	}
+	return nil
+}
+
+// handleNotFound is what the router calls for unmatched requests.
+func handleNotFound(w http.ResponseWriter, r *http.Request) {
+	if h := findFallback(r.URL.Path); h != nil {
+		h(w, r, nil)
+		return
+	}
+	notFound(w, r, nil)
+}
+
+// FallbackChain returns a handler that tries each of handlers in order until one handles the request.
+// A handler gives up by calling Pass or by responding with 404 Not Found, and then the next one is tried.
+// Each handler's response is buffered, so a handler that gives up doesn't send anything.
+// A handler that flushes its response (streams) is committed to it, and no more handlers are tried.
+// If every handler gives up, the last one's 404 is sent,
+// or if it called Pass without writing anything, a 404 error from ErrorRenderer.
+func FallbackChain(handlers ...HandleFn) HandleFn {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var last *chainWriter
+		for _, handle := range handlers {
+			passed := false
+			cw := &chainWriter{ResponseWriter: w, header: cloneHeader(w.Header())}
+			handle(context.WithValue(ctx, passKey, &passed), cw, r)
+			if cw.committed {
+				return
+			}
+			if !passed && cw.status != http.StatusNotFound {
+				cw.commit()
+				return
+			}
+			last = cw
+			if passed {
+				last = nil
+			}
+		}
+		if last != nil {
+			last.commit()
+			return
+		}
+		renderError(ctx, w, r, http.StatusNotFound)
+	}
+}
+
+// GetFallbackChain registers a GET handler under path that tries each of handlers in order. See FallbackChain.
+func GetFallbackChain(path string, handlers ...HandleFn) {
+	Get(path, FallbackChain(handlers...))
+}
+
+// WithFallback returns a handler that runs handle, but serves fallback instead if handle fails,
+// so a broken route can degrade to something like a cached page instead of an error.
+// A handler fails by panicking or by responding with a 5xx status.
+// In fallback, Exception(ctx) returns the panic value, or for a 5xx, an error with a StatusCode() int method.
+// The handler's response is buffered, so fallback always starts with a fresh writer,
+// though headers set by middleware before the handler are kept.
+// A handler that flushes its response (streams) is committed to it: later panics are handled as usual, without fallback.
+func WithFallback(handle, fallback HandleFn) HandleFn {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		cw := &chainWriter{ResponseWriter: w, header: cloneHeader(w.Header())}
+		exception := runFallible(ctx, handle, cw, r)
+		if cw.committed {
+			if exception != nil {
+				panic(exception)
+			}
+			return
+		}
+		if exception == nil && cw.status >= 500 {
+			exception = failedStatus(cw.status)
+		}
+		if exception == nil {
+			cw.commit()
+			return
+		}
+		log.Printf("kami: serving fallback for %s %s: %v", r.Method, r.URL.Path, exception)
+		fallback(newContextWithException(ctx, exception), w, r)
+	}
+}
+
+// GetWithFallback registers a GET handler under path that serves fallback if handle fails. See WithFallback.
+func GetWithFallback(path string, handle, fallback HandleFn) {
+	Get(path, WithFallback(handle, fallback))
+}
+
+// runFallible runs handle and returns what it panicked with, if anything.
+func runFallible(ctx context.Context, handle HandleFn, w http.ResponseWriter, r *http.Request) (exception interface{}) {
+	defer func() {
+		if exception = recover(); exception == http.ErrAbortHandler {
+			panic(exception)
+		}
+	}()
+	handle(ctx, w, r)
+	return nil
+}
+
+// failedStatus is the Exception for a WithFallback handler that responded with a 5xx status.
+type failedStatus int
+
+func (status failedStatus) Error() string {
+	return fmt.Sprintf("handler responded with %d %s", int(status), http.StatusText(int(status)))
+}
+
+func (status failedStatus) StatusCode() int {
+	return int(status)
+}
+
+// Pass tells FallbackChain that the current handler doesn't handle the request, so the next one should be tried.
+// Anything the handler wrote is thrown away.
+// It does nothing outside of FallbackChain.
+func Pass(ctx context.Context) {
+	if passed, ok := ctx.Value(passKey).(*bool); ok {
+		*passed = true
+	}
+}
+
+// chainWriter buffers a FallbackChain handler's response until it's known to be the one that handles the request.
+type chainWriter struct {
+	http.ResponseWriter
+	header    http.Header
+	status    int
+	buf       []byte
+	committed bool
+}
+
+func (cw *chainWriter) Header() http.Header {
+	if cw.committed {
+		return cw.ResponseWriter.Header()
+	}
+	return cw.header
+}
+
+func (cw *chainWriter) WriteHeader(code int) {
+	if cw.committed {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status == 0 {
+		cw.status = code
+	}
+}
+
+func (cw *chainWriter) Write(p []byte) (int, error) {
+	if cw.committed {
+		return cw.ResponseWriter.Write(p)
+	}
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.buf = append(cw.buf, p...)
+	return len(p), nil
+}
+
+// Flush commits to this handler's response, since it's streaming.
+func (cw *chainWriter) Flush() {
+	cw.commit()
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// commit sends the buffered response and passes everything else through.
+func (cw *chainWriter) commit() {
+	if cw.committed {
+		return
+	}
+	cw.committed = true
+	h := cw.ResponseWriter.Header()
+	for k := range h {
+		if _, ok := cw.header[k]; !ok {
+			delete(h, k)
+		}
+	}
+	for k, v := range cw.header {
+		h[k] = v
+	}
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	if len(cw.buf) > 0 {
+		cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+}
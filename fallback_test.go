@@ -0,0 +1,221 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestFallback(t *testing.T) {
+	kami.Reset()
+	reply := func(msg string) kami.HandleFn {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, msg)
+		}
+	}
+	kami.Use("/api/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		return context.WithValue(ctx, "api", true)
+	})
+	kami.Get("/api/users/:id", reply("user"))
+	kami.Post("/api/posts", reply("post"))
+	kami.Fallback("/api", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api" && ctx.Value("api") != true {
+			t.Error("middleware should run for fallbacks")
+		}
+		if kami.Matched(ctx) {
+			t.Error("fallbacks shouldn't count as matched")
+		}
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "api fallback")
+	})
+	kami.Fallback("/api/v2/", reply("v2 fallback"))
+	kami.NotFound(reply("not found"))
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/api/users/1", http.StatusOK, "user"},
+		{"GET", "/api/missing", http.StatusNotFound, "api fallback"},
+		{"GET", "/api", http.StatusNotFound, "api fallback"},
+		{"GET", "/api/v2/anything", http.StatusOK, "v2 fallback"},
+		{"GET", "/api/v2", http.StatusOK, "v2 fallback"},
+		{"GET", "/apiary", http.StatusOK, "not found"},
+		{"GET", "/other", http.StatusOK, "not found"},
+		{"GET", "/api/posts", http.StatusMethodNotAllowed, ""},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Error("unexpected status for", test.path, resp.Code, "≠", test.code)
+		}
+		if test.body != "" && resp.Body.String() != test.body {
+			t.Error("unexpected body for", test.path, resp.Body.String(), "≠", test.body)
+		}
+	}
+}
+
+func TestFallbackChain(t *testing.T) {
+	kami.Reset()
+	var tried []string
+	local := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		tried = append(tried, "local")
+		w.Header().Set("X-Local", "1")
+		io.WriteString(w, "partial")
+		if r.URL.Path != "/files/local.txt" {
+			kami.Pass(ctx)
+			return
+		}
+		io.WriteString(w, " local")
+	}
+	cache := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		tried = append(tried, "cache")
+		if r.URL.Path == "/files/missing.txt" || r.URL.Path == "/files/gone.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "not in cache")
+			return
+		}
+		io.WriteString(w, "cached")
+	}
+	remote := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		tried = append(tried, "remote")
+		if r.URL.Path == "/files/gone.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "remote 404")
+			return
+		}
+		kami.Pass(ctx)
+	}
+	kami.GetFallbackChain("/files/:name", local, cache, remote)
+
+	tests := []struct {
+		path  string
+		code  int
+		body  string
+		tried string
+	}{
+		{"/files/local.txt", http.StatusOK, "partial local", "local"},
+		{"/files/other.txt", http.StatusOK, "cached", "local cache"},
+		{"/files/gone.txt", http.StatusNotFound, "remote 404", "local cache remote"},
+		{"/files/missing.txt", http.StatusNotFound, "Not Found\n", "local cache remote"},
+	}
+	for _, test := range tests {
+		tried = nil
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Error("unexpected status for", test.path, resp.Code, "≠", test.code)
+		}
+		if resp.Body.String() != test.body {
+			t.Errorf("unexpected body for %s: %q ≠ %q", test.path, resp.Body.String(), test.body)
+		}
+		if got := strings.Join(tried, " "); got != test.tried {
+			t.Error("unexpected handlers tried for", test.path, got, "≠", test.tried)
+		}
+		if local := resp.Header().Get("X-Local"); (local != "") != (test.tried == "local") {
+			t.Error("headers from handlers that passed shouldn't be sent for", test.path)
+		}
+	}
+}
+
+func TestWithFallback(t *testing.T) {
+	kami.Reset()
+	var got []interface{}
+	cached := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		got = append(got, kami.Exception(ctx))
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, "<p>cached page</p>")
+	}
+	kami.Use("/pages/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		w.Header().Set("X-Middleware", "1")
+		return ctx
+	})
+	kami.GetWithFallback("/pages/panic", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("database is down")
+	}, cached)
+	kami.GetWithFallback("/pages/partial", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Partial", "1")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"half":`)
+		panic("lost connection")
+	}, cached)
+	kami.GetWithFallback("/pages/error", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "try later")
+	}, cached)
+	kami.GetWithFallback("/pages/ok", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "fresh page")
+	}, cached)
+
+	tests := []struct {
+		path      string
+		code      int
+		body      string
+		exception interface{}
+	}{
+		{"/pages/panic", http.StatusOK, "<p>cached page</p>", "database is down"},
+		{"/pages/partial", http.StatusOK, "<p>cached page</p>", "lost connection"},
+		{"/pages/error", http.StatusOK, "<p>cached page</p>", http.StatusServiceUnavailable},
+		{"/pages/ok", http.StatusCreated, "fresh page", nil},
+	}
+	for _, test := range tests {
+		got = nil
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Error("unexpected status for", test.path, resp.Code, "≠", test.code)
+		}
+		if resp.Body.String() != test.body {
+			t.Errorf("unexpected body for %s: %q ≠ %q", test.path, resp.Body.String(), test.body)
+		}
+		if resp.Header().Get("X-Middleware") != "1" {
+			t.Error("headers set by middleware should be kept for", test.path)
+		}
+		if resp.Header().Get("X-Partial") != "" {
+			t.Error("headers from the failed handler shouldn't be sent for", test.path)
+		}
+		if test.exception == nil {
+			if len(got) != 0 {
+				t.Error("fallback shouldn't run for", test.path)
+			}
+			continue
+		}
+		if len(got) != 1 {
+			t.Fatal("fallback should run once for", test.path, len(got))
+		}
+		if status, ok := test.exception.(int); ok {
+			coded, ok := got[0].(interface{ StatusCode() int })
+			if !ok || coded.StatusCode() != status {
+				t.Error("unexpected exception for", test.path, got[0])
+			}
+		} else if got[0] != test.exception {
+			t.Error("unexpected exception for", test.path, got[0], "≠", test.exception)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package kami
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+var background = struct {
+	sync.Mutex
+	wg      sync.WaitGroup
+	cancels map[*context.CancelFunc]struct{}
+}{cancels: make(map[*context.CancelFunc]struct{})}
+
+// Go runs fn in a new goroutine, for background work tied to a request.
+// fn's context is derived from ctx, so it's cancelled when the request is done,
+// and also when the server shuts down (see StopGo).
+// Panics in fn are recovered and sent to OnPanicReport, or logged if it isn't set.
+// The Serve functions wait for these goroutines when shutting down.
+func Go(ctx context.Context, fn func(context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+	background.Lock()
+	background.cancels[&cancel] = struct{}{}
+	background.wg.Add(1)
+	background.Unlock()
+
+	go func() {
+		defer func() {
+			background.Lock()
+			delete(background.cancels, &cancel)
+			background.Unlock()
+			cancel()
+			background.wg.Done()
+		}()
+		defer func() {
+			if v := recover(); v != nil {
+				reportBackgroundPanic(ctx, v)
+			}
+		}()
+		fn(ctx)
+	}()
+}
+
+// StopGo cancels the contexts of every goroutine started by Go, and waits for them to return.
+// If ctx is done first, it gives up and returns ctx.Err().
+// The Serve functions call it after in-flight requests have finished,
+// with the drain timeout from WithDrainTimeout, so only servers set up some other way need to call it.
+func StopGo(ctx context.Context) error {
+	background.Lock()
+	for cancel := range background.cancels {
+		(*cancel)()
+	}
+	background.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		background.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func reportBackgroundPanic(ctx context.Context, v interface{}) {
+	report := PanicReport{
+		Value:     v,
+		Stack:     debug.Stack(),
+		RequestID: RequestIDFrom(ctx),
+	}
+	if req := requestFrom(ctx); req != nil && req.r != nil {
+		report.Method = req.r.Method
+		report.Path = req.r.URL.Path
+		report.Header = sanitizeHeader(req.r.Header)
+		if report.RequestID == "" {
+			report.RequestID = req.r.Header.Get("X-Request-Id")
+		}
+	}
+	if OnPanicReport != nil {
+		OnPanicReport(report)
+		return
+	}
+	log.Printf("kami: panic in goroutine for %s %s: %v\n%s", report.Method, report.Path, v, report.Stack)
+}
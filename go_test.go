@@ -0,0 +1,101 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestGo(t *testing.T) {
+	kami.Reset()
+	reports := make(chan kami.PanicReport, 1)
+	kami.OnPanicReport = func(report kami.PanicReport) {
+		reports <- report
+	}
+	cancelled := make(chan error, 1)
+	kami.Get("/work", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Go(ctx, func(ctx context.Context) {
+			<-ctx.Done()
+			cancelled <- ctx.Err()
+		})
+	})
+	kami.Get("/explode", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Go(ctx, func(ctx context.Context) {
+			panic("boom")
+		})
+	})
+
+	// cancelled when the request is done
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/work", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	select {
+	case err := <-cancelled:
+		if err != context.Canceled {
+			t.Error("expected context.Canceled, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("goroutine should be cancelled when the request is done")
+	}
+
+	// panics are reported
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/explode", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	select {
+	case report := <-reports:
+		if report.Value != "boom" || report.Method != "GET" || report.Path != "/explode" {
+			t.Error("unexpected report:", report.Value, report.Method, report.Path)
+		}
+	case <-time.After(time.Second):
+		t.Error("panic should be reported")
+	}
+	if resp.Code != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+	}
+}
+
+func TestStopGo(t *testing.T) {
+	// cancels goroutines that aren't tied to a request
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan struct{})
+	kami.Go(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	if err := kami.StopGo(context.Background()); err != nil {
+		t.Error(err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("StopGo should wait for the goroutine")
+	}
+
+	// gives up when its context is done
+	release := make(chan struct{})
+	kami.Go(context.Background(), func(ctx context.Context) {
+		<-release
+	})
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelTimeout()
+	if err := kami.StopGo(timeout); err != context.DeadlineExceeded {
+		t.Error("expected context.DeadlineExceeded, got", err)
+	}
+	close(release)
+	if err := kami.StopGo(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,133 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package kami
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+// listenFDEnv tells a child started by ServeGraceful which file descriptor has the inherited listener.
+const listenFDEnv = "KAMI_LISTEN_FD"
+
+// parentPIDEnv tells a child started by ServeGraceful which process to stop once it's serving.
+const parentPIDEnv = "KAMI_PARENT_PID"
+
+// ServeGraceful runs kami on the given TCP address, with zero-downtime restarts. It's only available on Unix.
+//
+// When the process receives SIGUSR2, it starts a copy of itself (the same executable, arguments, and environment)
+// that inherits the listening socket, so no connections are refused during a deploy.
+// Once the child is serving, it sends SIGTERM to its parent, if the parent is still running.
+// On SIGTERM or SIGINT, ServeGraceful stops accepting connections, waits for in-flight requests
+// and goroutines started with Go to finish (see WithDrainTimeout), and returns nil.
+// It returns an error if the address can't be bound, or if the server fails.
+// If starting the child fails, the error is logged and the current process keeps serving.
+func ServeGraceful(addr string, opts ...ServeOption) error {
+	listener, parent, err := gracefulListener(addr)
+	if err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR2, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigs)
+
+	handler, cfg := serveHandler(opts)
+	srv := &http.Server{Handler: handler}
+	log.Println("Starting kami on", listener.Addr())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(listener)
+	}()
+
+	// we're ready, so the old process can stop
+	// if it already exited, we've been reparented, and Getppid is someone else (like init)
+	if parent != 0 && parent == os.Getppid() {
+		syscall.Kill(parent, syscall.SIGTERM)
+	}
+
+	for {
+		select {
+		case err := <-errc:
+			return err
+		case sig := <-sigs:
+			if sig == syscall.SIGUSR2 {
+				if err := handoff(listener); err != nil {
+					log.Println("kami: can't restart:", err)
+				}
+				continue
+			}
+			log.Printf("kami received %v, gracefully stopping", sig)
+			// closes the listener (our copy of it, the child has its own) and waits for in-flight requests
+			drain, cancel := cfg.drainContext()
+			if srv.Shutdown(drain) != nil {
+				srv.Close()
+			}
+			<-errc
+			StopGo(drain)
+			cancel()
+			log.Printf("kami stopped")
+			return nil
+		}
+	}
+}
+
+// gracefulListener returns the listener inherited from a parent ServeGraceful along with the parent's PID,
+// or binds a new one and returns a PID of 0.
+func gracefulListener(addr string) (net.Listener, int, error) {
+	fdstr := os.Getenv(listenFDEnv)
+	if fdstr == "" {
+		l, err := net.Listen("tcp", addr)
+		return l, 0, err
+	}
+	pidstr := os.Getenv(parentPIDEnv)
+	os.Unsetenv(listenFDEnv)
+	os.Unsetenv(parentPIDEnv)
+	fd, err := strconv.Atoi(fdstr)
+	if err != nil {
+		return nil, 0, fmt.Errorf("kami: bad %s: %q", listenFDEnv, fdstr)
+	}
+	// a bad or missing PID just means we don't stop anyone
+	pid, _ := strconv.Atoi(pidstr)
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	return l, pid, nil
+}
+
+// handoff starts a copy of this process that inherits listener.
+func handoff(listener net.Listener) error {
+	fl, ok := listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("kami: can't hand off a %T", listener)
+	}
+	f, err := fl.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles start at fd 3
+	cmd.ExtraFiles = []*os.File{f}
+	cmd.Env = append(os.Environ(), listenFDEnv+"=3", parentPIDEnv+"="+strconv.Itoa(os.Getpid()))
+	return cmd.Start()
+}
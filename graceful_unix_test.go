@@ -0,0 +1,153 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package kami_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestServeGracefulDrain(t *testing.T) {
+	kami.Reset()
+	kami.Get("/ping", noop)
+	started := make(chan struct{})
+	kami.Get("/slow", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	// find a free port to serve on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- kami.ServeGraceful(addr)
+	}()
+
+	// wait until it's serving, which also means it's listening for signals
+	for i := 0; i < 100; i++ {
+		var resp *http.Response
+		if resp, err = http.Get("http://" + addr + "/ping"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		slow <- result{string(data), err}
+	}()
+
+	<-started
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	// the in-flight request should finish
+	res := <-slow
+	if res.err != nil || res.body != "done" {
+		t.Error("in-flight request should be drained:", res.body, res.err)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Error("expected a clean shutdown, got", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeGraceful didn't return")
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("listener should be closed after shutdown")
+	}
+}
+
+func TestServeGracefulOrphan(t *testing.T) {
+	kami.Reset()
+	kami.Get("/ping", noop)
+
+	// pretend we're a child whose parent is gone: the PID we were given isn't our parent anymore
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("KAMI_LISTEN_FD", strconv.Itoa(fd))
+	// if ServeGraceful signalled this, it would stop itself
+	os.Setenv("KAMI_PARENT_PID", strconv.Itoa(os.Getpid()))
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- kami.ServeGraceful(addr)
+	}()
+	for i := 0; i < 100; i++ {
+		var resp *http.Response
+		if resp, err = http.Get("http://" + addr + "/ping"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv("KAMI_LISTEN_FD") != "" || os.Getenv("KAMI_PARENT_PID") != "" {
+		t.Error("inherited settings should be removed from the environment")
+	}
+
+	select {
+	case err := <-errc:
+		t.Fatal("ServeGraceful shouldn't signal a process that isn't its parent; it returned", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errc:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeGraceful didn't return")
+	}
+}
@@ -0,0 +1,187 @@
+package kami
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// RequireHeaders returns middleware that rejects requests missing any of the given headers with 400 Bad Request.
+// Headers that are present but empty count as missing.
+// The response is written by ClientError, with a message listing the missing headers.
+func RequireHeaders(names ...string) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		var missing []string
+		for _, name := range names {
+			if r.Header.Get(name) == "" {
+				missing = append(missing, http.CanonicalHeaderKey(name))
+			}
+		}
+		if len(missing) == 0 {
+			return ctx
+		}
+		ClientError(ctx, w, http.StatusBadRequest, "missing headers: "+strings.Join(missing, ", "))
+		return nil
+	}
+}
+
+// HeaderFilterOptions configures FilterResponseHeaders.
+type HeaderFilterOptions struct {
+	// Remove lists headers to strip from responses, like X-Powered-By.
+	Remove []string
+	// Allow, if set, lists the only headers that responses may have; everything else is stripped.
+	// Remember to include headers like Content-Type.
+	Allow []string
+}
+
+// FilterResponseHeaders returns middleware that strips response headers just before they're sent,
+// so it catches headers set by the handler and anything it calls.
+// Headers are filtered when the response is first written or flushed, so it works with streaming,
+// but headers added after that (which net/http ignores anyway) aren't filtered.
+// Headers that net/http adds itself, such as Date, aren't affected.
+func FilterResponseHeaders(opts HeaderFilterOptions) Middleware {
+	remove := make(map[string]bool, len(opts.Remove))
+	for _, name := range opts.Remove {
+		remove[http.CanonicalHeaderKey(name)] = true
+	}
+	var allow map[string]bool
+	if opts.Allow != nil {
+		allow = make(map[string]bool, len(opts.Allow))
+		for _, name := range opts.Allow {
+			allow[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		SetWriter(ctx, &headerFilterWriter{ResponseWriter: w, remove: remove, allow: allow})
+		return ctx
+	}
+}
+
+// headerFilterWriter strips headers before they're written.
+type headerFilterWriter struct {
+	http.ResponseWriter
+	remove   map[string]bool
+	allow    map[string]bool
+	filtered bool
+}
+
+func (hw *headerFilterWriter) filter() {
+	if hw.filtered {
+		return
+	}
+	hw.filtered = true
+	h := hw.ResponseWriter.Header()
+	for k := range h {
+		if hw.remove[k] || (hw.allow != nil && !hw.allow[k]) {
+			delete(h, k)
+		}
+	}
+}
+
+func (hw *headerFilterWriter) WriteHeader(code int) {
+	hw.filter()
+	hw.ResponseWriter.WriteHeader(code)
+}
+
+func (hw *headerFilterWriter) Write(p []byte) (int, error) {
+	hw.filter()
+	return hw.ResponseWriter.Write(p)
+}
+
+func (hw *headerFilterWriter) Flush() {
+	hw.filter()
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close filters the headers of responses that were never written to.
+func (hw *headerFilterWriter) Close() error {
+	hw.filter()
+	return nil
+}
+
+// MaxResponseHeaderSize returns middleware that guards against handlers sending huge response headers.
+// Just before the headers are sent, their total size (counting names, values, and separators) is checked,
+// and if it's over n bytes, the headers are thrown away, the problem is logged,
+// and a 500 error from ErrorRenderer is sent instead, along with nothing else the handler writes.
+// Headers that net/http adds itself, such as Date, aren't counted.
+func MaxResponseHeaderSize(n int) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		SetWriter(ctx, &headerLimitWriter{ResponseWriter: w, ctx: ctx, r: r, max: n})
+		return ctx
+	}
+}
+
+// headerLimitWriter checks the size of the headers before they're written.
+type headerLimitWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	r       *http.Request
+	max     int
+	checked bool
+	tooBig  bool
+}
+
+// check reports whether the headers are OK to send, replacing the response with an error if not.
+func (hw *headerLimitWriter) check() bool {
+	if hw.checked {
+		return !hw.tooBig
+	}
+	hw.checked = true
+	h := hw.ResponseWriter.Header()
+	size := headerSize(h)
+	if size <= hw.max {
+		return true
+	}
+	hw.tooBig = true
+	log.Printf("kami: response headers for %s %s are too big: %d bytes (max %d)", hw.r.Method, hw.r.URL.Path, size, hw.max)
+	for k := range h {
+		delete(h, k)
+	}
+	renderError(hw.ctx, hw.ResponseWriter, hw.r, http.StatusInternalServerError)
+	return false
+}
+
+// headerSize returns the size of h as it would be written: "Name: value\r\n" for every value.
+func headerSize(h http.Header) int {
+	size := 0
+	for k, vs := range h {
+		for _, v := range vs {
+			size += len(k) + len(v) + 4
+		}
+	}
+	return size
+}
+
+func (hw *headerLimitWriter) WriteHeader(code int) {
+	if hw.check() {
+		hw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (hw *headerLimitWriter) Write(p []byte) (int, error) {
+	if !hw.check() {
+		// the error has already been sent
+		return len(p), nil
+	}
+	return hw.ResponseWriter.Write(p)
+}
+
+func (hw *headerLimitWriter) Flush() {
+	if !hw.check() {
+		return
+	}
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close checks the headers of responses that were never written to.
+func (hw *headerLimitWriter) Close() error {
+	hw.check()
+	return nil
+}
@@ -0,0 +1,161 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestRequireHeaders(t *testing.T) {
+	kami.Reset()
+	kami.Post("/webhook", noop, kami.RequireHeaders("X-Signature", "x-timestamp"))
+
+	expect := []struct {
+		headers map[string]string
+		status  int
+		missing string
+	}{
+		{map[string]string{"X-Signature": "abc", "X-Timestamp": "1"}, http.StatusOK, ""},
+		{map[string]string{"X-Signature": "abc"}, http.StatusBadRequest, "X-Timestamp"},
+		{map[string]string{"X-Signature": "", "X-Timestamp": "1"}, http.StatusBadRequest, "X-Signature"},
+		{nil, http.StatusBadRequest, "X-Signature, X-Timestamp"},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/webhook", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.headers, resp.Code, "≠", e.status)
+		}
+		if e.missing != "" && !strings.Contains(resp.Body.String(), "missing headers: "+e.missing) {
+			t.Error("error should list the missing headers:", resp.Body.String())
+		}
+	}
+
+	// uses the error renderer
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/webhook", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	kami.Handler().ServeHTTP(resp, req)
+	if ct := resp.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Error("unexpected Content-Type:", ct)
+	}
+	if !strings.Contains(resp.Body.String(), `"detail":"missing headers: X-Signature, X-Timestamp"`) {
+		t.Error("unexpected body:", resp.Body.String())
+	}
+}
+
+func TestFilterResponseHeaders(t *testing.T) {
+	kami.Reset()
+	leaky := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Powered-By", "PHP/4.0")
+		w.Header().Set("X-Debug-Query", "SELECT * FROM users")
+		w.Header().Set("X-Request-Id", "abc")
+		if r.URL.Query().Get("stream") != "" {
+			w.(http.Flusher).Flush()
+		}
+		if r.URL.Query().Get("empty") == "" {
+			w.Write([]byte("hi"))
+		}
+	}
+	kami.Get("/remove", leaky, kami.FilterResponseHeaders(kami.HeaderFilterOptions{Remove: []string{"x-powered-by", "X-Debug-Query"}}))
+	kami.Get("/allow", leaky, kami.FilterResponseHeaders(kami.HeaderFilterOptions{Allow: []string{"Content-Type"}}))
+
+	expect := []struct {
+		path    string
+		present []string
+		absent  []string
+	}{
+		{"/remove", []string{"Content-Type", "X-Request-Id"}, []string{"X-Powered-By", "X-Debug-Query"}},
+		{"/remove?stream=1", []string{"Content-Type", "X-Request-Id"}, []string{"X-Powered-By", "X-Debug-Query"}},
+		{"/remove?empty=1", []string{"Content-Type", "X-Request-Id"}, []string{"X-Powered-By", "X-Debug-Query"}},
+		{"/allow", []string{"Content-Type"}, []string{"X-Powered-By", "X-Debug-Query", "X-Request-Id"}},
+	}
+	for _, e := range expect {
+		// use a real server to check what's actually sent
+		srv := httptest.NewServer(kami.Handler())
+		resp, err := http.Get(srv.URL + e.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		srv.Close()
+
+		for _, name := range e.present {
+			if resp.Header.Get(name) == "" {
+				t.Error("header should be kept for", e.path, name)
+			}
+		}
+		for _, name := range e.absent {
+			if v := resp.Header.Get(name); v != "" {
+				t.Error("header should be removed for", e.path, name, v)
+			}
+		}
+	}
+}
+
+func TestMaxResponseHeaderSize(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.MaxResponseHeaderSize(1024))
+	huge := func(write bool) kami.HandleFn {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 100; i++ {
+				w.Header().Add("X-Junk", strings.Repeat("x", 100))
+			}
+			if write {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("secret"))
+			}
+		}
+	}
+	kami.Get("/huge", huge(true))
+	kami.Get("/unwritten", huge(false))
+	kami.Get("/ok", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Fine", "yes")
+		w.Write([]byte("ok"))
+	})
+
+	for _, path := range []string{"/huge", "/unwritten"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != http.StatusInternalServerError {
+			t.Error("oversized headers should give a 500 for", path, resp.Code)
+		}
+		if len(resp.Header()["X-Junk"]) > 0 {
+			t.Error("oversized headers shouldn't be sent for", path)
+		}
+		if strings.Contains(resp.Body.String(), "secret") {
+			t.Error("the handler's body shouldn't be sent:", resp.Body.String())
+		}
+	}
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/ok", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Header().Get("X-Fine") != "yes" || resp.Body.String() != "ok" {
+		t.Error("small headers should be left alone:", resp.Code, resp.Header(), resp.Body.String())
+	}
+}
@@ -0,0 +1,79 @@
+package kami
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// AllowedHosts returns middleware that rejects requests with a Host header that isn't one of hosts with 400 Bad Request,
+// to protect against Host header injection, such as poisoned caches or password reset links pointing somewhere else.
+// A host starting with *. matches any subdomain: *.example.com matches api.example.com and a.b.example.com, but not example.com.
+// Hosts are compared case-insensitively, ignoring ports and trailing dots.
+// Register it under "/" before any other middleware. The response is written by ClientError.
+func AllowedHosts(hosts ...string) Middleware {
+	exact := make(map[string]bool, len(hosts))
+	var wildcards []string
+	for _, host := range hosts {
+		host = canonicalHostname(host)
+		if strings.HasPrefix(host, "*.") {
+			wildcards = append(wildcards, host[1:])
+		} else {
+			exact[host] = true
+		}
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		host := canonicalHostname(r.Host)
+		if exact[host] {
+			return ctx
+		}
+		for _, suffix := range wildcards {
+			if len(host) > len(suffix) && strings.HasSuffix(host, suffix) {
+				return ctx
+			}
+		}
+		// don't echo the host back, since it came from the attacker
+		ClientError(ctx, w, http.StatusBadRequest, "unknown host")
+		return nil
+	}
+}
+
+// CanonicalHost returns middleware that redirects requests for any other host to target,
+// such as www.example.com to example.com, keeping the scheme, path, and query.
+// target can include a port. code is the redirect status;
+// if it's 0, GET and HEAD requests are redirected with 301 Moved Permanently,
+// and other methods with 308 Permanent Redirect so that the method and body are kept.
+// Register it under "/" before any other middleware, after AllowedHosts if you use both.
+func CanonicalHost(target string, code int) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if strings.EqualFold(r.Host, target) {
+			return ctx
+		}
+
+		status := code
+		if status == 0 {
+			status = http.StatusPermanentRedirect
+			if r.Method == "GET" || r.Method == "HEAD" {
+				status = http.StatusMovedPermanently
+			}
+		}
+		scheme := "http://"
+		if r.TLS != nil {
+			scheme = "https://"
+		}
+		http.Redirect(w, r, scheme+target+r.URL.RequestURI(), status)
+		return nil
+	}
+}
+
+// canonicalHostname lowercases host and strips its port and trailing dot.
+func canonicalHostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimPrefix(strings.TrimSuffix(host, "]"), "[")
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,95 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/guregu/kami"
+)
+
+func TestAllowedHosts(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.AllowedHosts("example.com", "*.example.net", "[::1]"))
+	kami.Get("/", noop)
+
+	expect := map[string]int{
+		"example.com":      http.StatusOK,
+		"EXAMPLE.com:8080": http.StatusOK,
+		"example.com.":     http.StatusOK,
+		"api.example.net":  http.StatusOK,
+		"a.b.example.net":  http.StatusOK,
+		"[::1]:443":        http.StatusOK,
+		"example.net":      http.StatusBadRequest,
+		"evilexample.net":  http.StatusBadRequest,
+		"www.example.com":  http.StatusBadRequest,
+		"example.com.evil": http.StatusBadRequest,
+		"":                 http.StatusBadRequest,
+	}
+	for host, status := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != status {
+			t.Error("unexpected status for", host, resp.Code, "≠", status)
+		}
+	}
+}
+
+func TestCanonicalHost(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.CanonicalHost("example.com", 0))
+	kami.Get("/page", noop)
+	kami.Post("/form", noop)
+
+	tests := []struct {
+		method, host string
+		status       int
+		location     string
+	}{
+		{"GET", "example.com", http.StatusOK, ""},
+		{"GET", "Example.COM", http.StatusOK, ""},
+		{"GET", "www.example.com", http.StatusMovedPermanently, "http://example.com/page?q=1"},
+		{"POST", "www.example.com", http.StatusPermanentRedirect, "http://example.com/form?q=1"},
+	}
+	for _, test := range tests {
+		path := "/page?q=1"
+		if test.method == "POST" {
+			path = "/form?q=1"
+		}
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(test.method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = test.host
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.status {
+			t.Error("unexpected status for", test.method, test.host, resp.Code, "≠", test.status)
+		}
+		if loc := resp.Header().Get("Location"); loc != test.location {
+			t.Error("unexpected Location for", test.method, test.host, loc, "≠", test.location)
+		}
+	}
+
+	// explicit code
+	kami.Reset()
+	kami.Use("/", kami.CanonicalHost("www.example.com:8443", http.StatusFound))
+	kami.Get("/", noop)
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "example.com"
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusFound || resp.Header().Get("Location") != "http://www.example.com:8443/" {
+		t.Error("unexpected redirect:", resp.Code, resp.Header().Get("Location"))
+	}
+}
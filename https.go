@@ -0,0 +1,57 @@
+package kami
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// HTTPSOptions configures RequireHTTPS.
+type HTTPSOptions struct {
+	// TrustForwarded decides whether to trust the X-Forwarded-Proto header of a request,
+	// for example by checking that r.RemoteAddr is your load balancer.
+	// If nil, X-Forwarded-Proto is never trusted, because clients can spoof it.
+	TrustForwarded func(r *http.Request) bool
+	// NoRedirect rejects insecure requests with 403 Forbidden instead of redirecting them.
+	NoRedirect bool
+}
+
+// RequireHTTPS returns middleware that redirects plain HTTP requests to HTTPS.
+// GET and HEAD requests are redirected with 301 Moved Permanently,
+// and other methods with 308 Permanent Redirect so that the method and body are kept.
+// Register it under "/" before any other middleware, so insecure requests are handled early.
+func RequireHTTPS(opts HTTPSOptions) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if isHTTPS(r, opts.TrustForwarded) {
+			return ctx
+		}
+
+		if opts.NoRedirect {
+			ClientError(ctx, w, http.StatusForbidden, "HTTPS is required")
+			return nil
+		}
+
+		code := http.StatusPermanentRedirect
+		if r.Method == "GET" || r.Method == "HEAD" {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), code)
+		return nil
+	}
+}
+
+func isHTTPS(r *http.Request, trust func(*http.Request) bool) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if trust == nil || !trust(r) {
+		return false
+	}
+	// the header may be a list if there are several proxies; the first is the client's
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if i := strings.IndexByte(proto, ','); i >= 0 {
+		proto = proto[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
@@ -0,0 +1,67 @@
+package kami_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/guregu/kami"
+)
+
+func TestRequireHTTPS(t *testing.T) {
+	trustLB := func(r *http.Request) bool {
+		return strings.HasPrefix(r.RemoteAddr, "10.0.0.1:")
+	}
+
+	tests := []struct {
+		opts     kami.HTTPSOptions
+		method   string
+		tls      bool
+		proto    string
+		remote   string
+		code     int
+		location string
+	}{
+		// direct
+		{kami.HTTPSOptions{}, "GET", true, "", "1.2.3.4:1234", http.StatusOK, ""},
+		{kami.HTTPSOptions{}, "GET", false, "", "1.2.3.4:1234", http.StatusMovedPermanently, "https://example.com/secure?a=b"},
+		{kami.HTTPSOptions{}, "POST", false, "", "1.2.3.4:1234", http.StatusPermanentRedirect, "https://example.com/secure?a=b"},
+		{kami.HTTPSOptions{NoRedirect: true}, "GET", false, "", "1.2.3.4:1234", http.StatusForbidden, ""},
+		// spoofed header without trust
+		{kami.HTTPSOptions{}, "GET", false, "https", "1.2.3.4:1234", http.StatusMovedPermanently, "https://example.com/secure?a=b"},
+		// proxied
+		{kami.HTTPSOptions{TrustForwarded: trustLB}, "GET", false, "https", "10.0.0.1:1234", http.StatusOK, ""},
+		{kami.HTTPSOptions{TrustForwarded: trustLB}, "GET", false, "https, http", "10.0.0.1:1234", http.StatusOK, ""},
+		{kami.HTTPSOptions{TrustForwarded: trustLB}, "GET", false, "http", "10.0.0.1:1234", http.StatusMovedPermanently, "https://example.com/secure?a=b"},
+		{kami.HTTPSOptions{TrustForwarded: trustLB}, "GET", false, "https", "1.2.3.4:1234", http.StatusMovedPermanently, "https://example.com/secure?a=b"},
+	}
+
+	for i, test := range tests {
+		kami.Reset()
+		kami.Use("/", kami.RequireHTTPS(test.opts))
+		kami.Handle(test.method, "/secure", noop)
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(test.method, "http://example.com/secure?a=b", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = test.remote
+		if test.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if test.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Error(i, "unexpected status", resp.Code, "≠", test.code)
+		}
+		if loc := resp.Header().Get("Location"); loc != test.location {
+			t.Error(i, "unexpected location", loc, "≠", test.location)
+		}
+	}
+}
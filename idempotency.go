@@ -0,0 +1,276 @@
+package kami
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// IdempotencyStore keeps track of requests made with an Idempotency-Key, for Idempotency.
+// Implementations must be safe for concurrent use, and Begin must be atomic,
+// so with something like Redis it should use SET NX or a transaction.
+type IdempotencyStore interface {
+	// Begin claims key for a new request, whose body has the given fingerprint.
+	// If the key was already used with a different fingerprint, it returns ErrIdempotencyMismatch.
+	// If the key already has a completed response, it returns that response.
+	// If another request with the key is still running, it returns nil and false.
+	// Otherwise, it marks the key as in flight and returns nil and true.
+	Begin(ctx context.Context, key, fingerprint string) (resp *Response, started bool, err error)
+	// Complete saves the response for a key claimed with Begin.
+	Complete(ctx context.Context, key string, resp *Response) error
+	// Abort releases a key claimed with Begin without saving a response, so the request can be retried.
+	Abort(ctx context.Context, key string) error
+}
+
+// ErrIdempotencyMismatch is returned by IdempotencyStore.Begin when a key is reused for a request with a different body.
+var ErrIdempotencyMismatch = errors.New("kami: Idempotency-Key was already used for a different request")
+
+// IdempotencyOption configures Idempotency.
+type IdempotencyOption func(*idempotencyConfig)
+
+type idempotencyConfig struct {
+	scope func(context.Context, *http.Request) string
+}
+
+// IdempotencyKeyFunc makes Idempotency scope keys with fn, which should return who the request is from,
+// such as the authenticated user's ID. Requests are only replayed for the same scope, method, path, and key.
+// Without it, keys are shared by every client, so anyone who sends (or guesses) another client's key gets their response.
+// It's required when there's more than one user, and Idempotency must then run after the middleware that authenticates them.
+func IdempotencyKeyFunc(fn func(ctx context.Context, r *http.Request) string) IdempotencyOption {
+	return func(cfg *idempotencyConfig) {
+		cfg.scope = fn
+	}
+}
+
+// IdempotencyMaxSize is the largest response body that Idempotency will save.
+// Bigger responses, and streamed ones, are sent as usual but not saved, so retries run the handler again.
+const IdempotencyMaxSize = 1 << 20
+
+// Idempotency returns middleware that makes retries of unsafe requests (like POST) safe,
+// for clients that send an Idempotency-Key header, such as for payments.
+// The first request with a key runs as usual, and its response is saved in store.
+// Later requests with the same key, method, and path get the saved response again,
+// with an Idempotent-Replayed: true header, without running the handler.
+// When there's more than one user, use IdempotencyKeyFunc to keep their keys apart.
+// The request body is read to fingerprint it, and a key that's reused with a different body gets 422 Unprocessable Entity
+// from ClientError instead of a replay.
+// A request whose key is still in flight gets 409 Conflict from ClientError.
+// Responses aren't saved if the handler panics or responds with a 5xx error, so those can be retried.
+// Requests with safe methods (GET, HEAD, OPTIONS, TRACE) or without the header are left alone.
+// If the store returns an error, it's logged and the request gets a 500 error.
+func Idempotency(store IdempotencyStore, opts ...IdempotencyOption) Middleware {
+	var cfg idempotencyConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		idemKey := r.Header.Get("Idempotency-Key")
+		if idemKey == "" || isSafeMethod(r.Method) {
+			return ctx
+		}
+		key := r.Method + " " + r.URL.Path + " " + idemKey
+		if cfg.scope != nil {
+			key = cfg.scope(ctx, r) + " " + key
+		}
+		body, err := BufferBody(r)
+		if err != nil {
+			ClientError(ctx, w, http.StatusBadRequest, "can't read request body")
+			return nil
+		}
+		sum := sha256.Sum256(body)
+
+		resp, started, err := store.Begin(ctx, key, hex.EncodeToString(sum[:]))
+		if errors.Is(err, ErrIdempotencyMismatch) {
+			ClientError(ctx, w, http.StatusUnprocessableEntity, "this Idempotency-Key was already used for a different request")
+			return nil
+		}
+		if err != nil {
+			log.Printf("kami: idempotency store error for %s %s: %v", r.Method, r.URL.Path, err)
+			renderError(ctx, w, r, http.StatusInternalServerError)
+			return nil
+		}
+		if resp != nil {
+			replayResponse(w, resp)
+			return Halt(ctx)
+		}
+		if !started {
+			ClientError(ctx, w, http.StatusConflict, "a request with this Idempotency-Key is already in progress")
+			return nil
+		}
+
+		iw := &idempotencyWriter{ResponseWriter: w, ctx: ctx, store: store, key: key}
+		SetWriter(ctx, iw)
+		// in case we panic without kami recovering
+		Defer(ctx, func() { iw.finish(false) })
+		return ctx
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+func replayResponse(w http.ResponseWriter, resp *Response) {
+	h := w.Header()
+	for k, v := range resp.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("Idempotent-Replayed", "true")
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(resp.Body)
+}
+
+// idempotencyWriter records the response while sending it, and saves it when closed.
+type idempotencyWriter struct {
+	http.ResponseWriter
+	ctx   context.Context
+	store IdempotencyStore
+	key   string
+	resp  Response
+	// unsaveable is set once the response is too big or streamed.
+	unsaveable bool
+	finished   bool
+}
+
+func (iw *idempotencyWriter) WriteHeader(code int) {
+	if iw.resp.Status == 0 {
+		iw.resp.Status = code
+		iw.resp.Header = cloneHeader(iw.Header())
+	}
+	iw.ResponseWriter.WriteHeader(code)
+}
+
+func (iw *idempotencyWriter) Write(p []byte) (int, error) {
+	if iw.resp.Status == 0 {
+		iw.WriteHeader(http.StatusOK)
+	}
+	if !iw.unsaveable {
+		if len(iw.resp.Body)+len(p) > IdempotencyMaxSize {
+			iw.unsaveable = true
+			iw.resp.Body = nil
+		} else {
+			iw.resp.Body = append(iw.resp.Body, p...)
+		}
+	}
+	return iw.ResponseWriter.Write(p)
+}
+
+// Flush means the response is being streamed, so it isn't saved.
+func (iw *idempotencyWriter) Flush() {
+	iw.unsaveable = true
+	iw.resp.Body = nil
+	if f, ok := iw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close is called after the handler and saves the response.
+func (iw *idempotencyWriter) Close() error {
+	iw.finish(!iw.unsaveable && Exception(iw.ctx) == nil)
+	return nil
+}
+
+// finish saves the response if save is true, or aborts otherwise.
+func (iw *idempotencyWriter) finish(save bool) {
+	if iw.finished {
+		return
+	}
+	iw.finished = true
+	if iw.resp.Status == 0 {
+		iw.resp.Status = http.StatusOK
+	}
+	if iw.resp.Header == nil {
+		iw.resp.Header = cloneHeader(iw.Header())
+	}
+	var err error
+	if save && iw.resp.Status < 500 {
+		err = iw.store.Complete(iw.ctx, iw.key, &iw.resp)
+	} else {
+		err = iw.store.Abort(iw.ctx, iw.key)
+	}
+	if err != nil {
+		log.Printf("kami: idempotency store error for key %q: %v", iw.key, err)
+	}
+}
+
+// NewMemoryIdempotencyStore returns an IdempotencyStore that keeps responses in memory for ttl.
+// Keys that are in flight for longer than ttl are released too, in case a request never finishes.
+// It's fine for a single server; use a shared store when running more than one.
+func NewMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	return &memoryIdempotencyStore{ttl: ttl, entries: make(map[string]*idempotencyEntry)}
+}
+
+type memoryIdempotencyStore struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+type idempotencyEntry struct {
+	// resp is nil while the request is in flight.
+	resp        *Response
+	fingerprint string
+	expires     time.Time
+}
+
+func (s *memoryIdempotencyStore) Begin(ctx context.Context, key, fingerprint string) (*Response, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		if e.fingerprint != fingerprint {
+			return nil, false, ErrIdempotencyMismatch
+		}
+		return e.resp, false, nil
+	}
+	s.entries[key] = &idempotencyEntry{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, key string, resp *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var fingerprint string
+	if e, ok := s.entries[key]; ok {
+		fingerprint = e.fingerprint
+	}
+	s.entries[key] = &idempotencyEntry{resp: resp, fingerprint: fingerprint, expires: time.Now().Add(s.ttl)}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Abort(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep removes expired entries, at most once per ttl.
+func (s *memoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package kami_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestIdempotency(t *testing.T) {
+	var charges int32
+	release := make(chan struct{})
+	entered := make(chan struct{}, 1)
+
+	kami.Reset()
+	kami.Use("/", kami.Idempotency(kami.NewMemoryIdempotencyStore(time.Minute)))
+	kami.Post("/charge", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&charges, 1)
+		w.Header().Set("X-Charge", strconv.Itoa(int(n)))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "charge "+strconv.Itoa(int(n)))
+	})
+	kami.Post("/slow", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		io.WriteString(w, "slow")
+	})
+	kami.Post("/flaky", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&charges, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	do := func(method, path, key string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	// replay
+	first := do("POST", "/charge", "abc")
+	again := do("POST", "/charge", "abc")
+	if charges != 1 {
+		t.Error("retrying with the same key shouldn't run the handler again; charges:", charges)
+	}
+	if again.Code != http.StatusCreated || again.Body.String() != first.Body.String() || again.Header().Get("X-Charge") != "1" {
+		t.Error("retry should replay the first response:", again.Code, again.Body.String(), again.Header())
+	}
+	if again.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("only replays should have Idempotent-Replayed")
+	}
+
+	// different keys, no key
+	if resp := do("POST", "/charge", "xyz"); resp.Body.String() != "charge 2" {
+		t.Error("a new key should run the handler:", resp.Body.String())
+	}
+	if resp := do("POST", "/charge", ""); resp.Body.String() != "charge 3" {
+		t.Error("requests without a key should run the handler:", resp.Body.String())
+	}
+
+	// 5xx responses aren't saved
+	atomic.StoreInt32(&charges, 0)
+	do("POST", "/flaky", "f")
+	do("POST", "/flaky", "f")
+	if charges != 2 {
+		t.Error("5xx responses shouldn't be replayed; calls:", charges)
+	}
+
+	// concurrent duplicate
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- do("POST", "/slow", "dup")
+	}()
+	<-entered
+	if resp := do("POST", "/slow", "dup"); resp.Code != http.StatusConflict {
+		t.Error("a duplicate of an in-flight request should get 409:", resp.Code)
+	}
+	close(release)
+	if resp := <-done; resp.Code != http.StatusOK || resp.Body.String() != "slow" {
+		t.Error("unexpected response for the first request:", resp.Code, resp.Body.String())
+	}
+	if resp := do("POST", "/slow", "dup"); resp.Body.String() != "slow" || resp.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("the finished request should be replayed:", resp.Body.String())
+	}
+}
+
+func TestMemoryIdempotencyStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	store := kami.NewMemoryIdempotencyStore(20 * time.Millisecond)
+	if _, started, _ := store.Begin(ctx, "k", "fp"); !started {
+		t.Fatal("first Begin should start")
+	}
+	store.Complete(ctx, "k", &kami.Response{Status: 200, Body: []byte("ok")})
+	if resp, _, _ := store.Begin(ctx, "k", "fp"); resp == nil || string(resp.Body) != "ok" {
+		t.Error("completed responses should be returned:", resp)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if resp, started, _ := store.Begin(ctx, "k", "fp"); resp != nil || !started {
+		t.Error("expired keys should start over:", resp, started)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	var charges int32
+	kami.Reset()
+	kami.Use("/", kami.Idempotency(kami.NewMemoryIdempotencyStore(time.Minute),
+		kami.IdempotencyKeyFunc(func(ctx context.Context, r *http.Request) string {
+			return r.Header.Get("X-User")
+		})))
+	kami.Post("/charge", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&charges, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		io.WriteString(w, r.Header.Get("X-User")+" charge "+strconv.Itoa(int(n))+" "+string(body))
+	})
+
+	do := func(user, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/charge", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Idempotency-Key", "same")
+		req.Header.Set("X-User", user)
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := do("alice", "$10"); resp.Body.String() != "alice charge 1 $10" {
+		t.Error("unexpected first response:", resp.Body.String())
+	}
+	if resp := do("alice", "$10"); resp.Body.String() != "alice charge 1 $10" || resp.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("the same user should get a replay:", resp.Body.String())
+	}
+	if resp := do("mallory", "$10"); resp.Body.String() != "mallory charge 2 $10" {
+		t.Error("another user with the same key shouldn't get a replay:", resp.Body.String())
+	}
+
+	// reusing a key for a different request
+	resp := do("alice", "$1000")
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Error("reusing a key with a different body should get 422:", resp.Code)
+	}
+	if charges != 2 {
+		t.Error("reused keys shouldn't run the handler; charges:", charges)
+	}
+}
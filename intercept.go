@@ -0,0 +1,155 @@
+package kami
+
+import (
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/context"
+)
+
+// Response is a buffered response, for ResponseInterceptor.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// InterceptOption configures ResponseInterceptor.
+type InterceptOption func(*interceptor)
+
+// InterceptMaxSize sets the largest response body that ResponseInterceptor will buffer.
+// Bigger responses are sent as-is, without calling the interceptor. The default is 1MB.
+func InterceptMaxSize(n int) InterceptOption {
+	return func(ic *interceptor) {
+		ic.maxSize = n
+	}
+}
+
+type interceptor struct {
+	fn      func(context.Context, *Response) *Response
+	maxSize int
+}
+
+// ResponseInterceptor returns middleware that buffers the response and passes it to fn before anything is sent,
+// so fn can rewrite the status, headers, and body, for example to wrap a payload in an envelope.
+// fn can modify the Response it's given and return it, or return a different one; returning nil sends the original.
+// Content-Length is set to the length of the final body.
+// Responses that are flushed (streamed) or bigger than the maximum size are sent as they are, without calling fn,
+// and so are responses from handlers that panic.
+// Register ResponseInterceptor after Compress to intercept the uncompressed body before it's compressed.
+func ResponseInterceptor(fn func(context.Context, *Response) *Response, opts ...InterceptOption) Middleware {
+	ic := &interceptor{fn: fn, maxSize: 1 << 20}
+	for _, opt := range opts {
+		opt(ic)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		SetWriter(ctx, &interceptWriter{ResponseWriter: w, ic: ic, ctx: ctx, header: cloneHeader(w.Header())})
+		return ctx
+	}
+}
+
+// interceptWriter buffers a response until it's closed, unless it has to give up and pass it through.
+type interceptWriter struct {
+	http.ResponseWriter
+	ic     *interceptor
+	ctx    context.Context
+	header http.Header
+	status int
+	buf    []byte
+	// passthrough is true once the response is going straight to the client.
+	passthrough bool
+}
+
+func (iw *interceptWriter) Header() http.Header {
+	if iw.passthrough {
+		return iw.ResponseWriter.Header()
+	}
+	return iw.header
+}
+
+func (iw *interceptWriter) WriteHeader(code int) {
+	if iw.passthrough {
+		iw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if iw.status == 0 {
+		iw.status = code
+	}
+}
+
+func (iw *interceptWriter) Write(p []byte) (int, error) {
+	if iw.passthrough {
+		return iw.ResponseWriter.Write(p)
+	}
+	if len(iw.buf)+len(p) > iw.ic.maxSize {
+		if err := iw.bypass(); err != nil {
+			return 0, err
+		}
+		return iw.ResponseWriter.Write(p)
+	}
+	iw.buf = append(iw.buf, p...)
+	return len(p), nil
+}
+
+// Flush means the handler is streaming, so stop buffering.
+func (iw *interceptWriter) Flush() {
+	iw.bypass()
+	if f, ok := iw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// bypass sends the buffered response as-is and passes everything else through.
+func (iw *interceptWriter) bypass() error {
+	if iw.passthrough {
+		return nil
+	}
+	return iw.send(&Response{Status: iw.status, Header: iw.header, Body: iw.buf})
+}
+
+// Close calls the interceptor and sends its response.
+func (iw *interceptWriter) Close() error {
+	if iw.passthrough {
+		return nil
+	}
+	if req := requestFrom(iw.ctx); req != nil && req.exception != nil {
+		// the panic handler will respond
+		iw.passthrough = true
+		return nil
+	}
+	resp := &Response{Status: iw.status, Header: iw.header, Body: iw.buf}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	if out := iw.ic.fn(iw.ctx, resp); out != nil {
+		resp = out
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	return iw.send(resp)
+}
+
+// send writes resp to the underlying writer.
+func (iw *interceptWriter) send(resp *Response) error {
+	iw.passthrough = true
+	h := iw.ResponseWriter.Header()
+	for k := range h {
+		if _, ok := resp.Header[k]; !ok {
+			delete(h, k)
+		}
+	}
+	for k, v := range resp.Header {
+		h[k] = v
+	}
+	if resp.Status != 0 {
+		iw.ResponseWriter.WriteHeader(resp.Status)
+	}
+	if len(resp.Body) == 0 {
+		return nil
+	}
+	_, err := iw.ResponseWriter.Write(resp.Body)
+	return err
+}
@@ -0,0 +1,112 @@
+package kami_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func envelope(ctx context.Context, resp *kami.Response) *kami.Response {
+	if resp.Header.Get("Content-Type") != "application/json" {
+		return nil
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"status": resp.Status,
+		"data":   json.RawMessage(resp.Body),
+	})
+	resp.Status = http.StatusOK
+	resp.Body = data
+	resp.Header.Set("X-Enveloped", "true")
+	return resp
+}
+
+func TestResponseInterceptor(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.ResponseInterceptor(envelope, kami.InterceptMaxSize(64)))
+	kami.Get("/user", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.JSON(w, http.StatusCreated, map[string]string{"name": "bob"})
+	})
+	kami.Get("/text", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	})
+	kami.Get("/big", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`"` + strings.Repeat("x", 100) + `"`))
+	})
+	kami.Get("/stream", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("1"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("2"))
+	})
+
+	expect := []struct {
+		path      string
+		status    int
+		body      string
+		enveloped bool
+	}{
+		{"/user", http.StatusOK, `{"data":{"name":"bob"},"status":201}`, true},
+		{"/text", http.StatusOK, "plain", false},
+		{"/big", http.StatusOK, `"` + strings.Repeat("x", 100) + `"`, false},
+		{"/stream", http.StatusOK, "12", false},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.path, resp.Code, "≠", e.status)
+		}
+		if body := strings.TrimSpace(resp.Body.String()); body != e.body {
+			t.Error("unexpected body for", e.path, body, "≠", e.body)
+		}
+		if enveloped := resp.Header().Get("X-Enveloped") == "true"; enveloped != e.enveloped {
+			t.Error("unexpected interception for", e.path, enveloped)
+		}
+	}
+}
+
+func TestResponseInterceptorCompress(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.Compress(kami.CompressMinSize(0)))
+	kami.Use("/", kami.ResponseInterceptor(envelope))
+	kami.Get("/user", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.JSON(w, http.StatusOK, map[string]string{"name": "bob"})
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/user", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("response should be compressed")
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"data":{"name":"bob"},"status":200}`; string(bytes.TrimSpace(data)) != want {
+		t.Error("interceptor should run before compression:", string(data), "≠", want)
+	}
+}
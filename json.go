@@ -0,0 +1,88 @@
+package kami
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// JSONEncoder writes a stream of JSON values, like *json.Encoder.
+type JSONEncoder interface {
+	Encode(v interface{}) error
+}
+
+var (
+	jsonMarshal   = json.Marshal
+	jsonUnmarshal = json.Unmarshal
+	newEncoder    = stdEncoder
+)
+
+func stdEncoder(w io.Writer) JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+// SetJSONCodec changes the JSON library used by JSON, BindJSON, Bind, Problem, and NewJSONEncoder,
+// for example to use jsoniter's Marshal and Unmarshal.
+// Passing nil for either goes back to encoding/json's.
+// This also resets the encoder set by SetJSONEncoder.
+func SetJSONCodec(marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) {
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	jsonUnmarshal = unmarshal
+	if marshal == nil {
+		jsonMarshal = json.Marshal
+		newEncoder = stdEncoder
+		return
+	}
+	jsonMarshal = marshal
+	newEncoder = func(w io.Writer) JSONEncoder {
+		return marshalEncoder{w}
+	}
+}
+
+// SetJSONEncoder changes how NewJSONEncoder makes encoders, for libraries that have their own streaming encoder.
+// By default, or if fn is nil, encoders use the marshal function from SetJSONCodec.
+func SetJSONEncoder(fn func(w io.Writer) JSONEncoder) {
+	if fn == nil {
+		fn = func(w io.Writer) JSONEncoder {
+			return marshalEncoder{w}
+		}
+	}
+	newEncoder = fn
+}
+
+// marshalEncoder is a JSONEncoder that uses jsonMarshal.
+type marshalEncoder struct {
+	w io.Writer
+}
+
+func (enc marshalEncoder) Encode(v interface{}) error {
+	data, err := jsonMarshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = enc.w.Write(append(data, '\n'))
+	return err
+}
+
+// NewJSONEncoder returns an encoder writing to w, for streaming JSON values one after another.
+func NewJSONEncoder(w io.Writer) JSONEncoder {
+	return newEncoder(w)
+}
+
+// JSON writes v as a JSON response with the given status.
+// The Content-Type is set to application/json unless it has already been set.
+// If v can't be encoded, nothing is written and the error is returned.
+func JSON(w http.ResponseWriter, status int, v interface{}) error {
+	data, err := jsonMarshal(v)
+	if err != nil {
+		return err
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
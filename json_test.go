@@ -0,0 +1,88 @@
+package kami_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/guregu/kami"
+)
+
+func TestJSON(t *testing.T) {
+	resp := httptest.NewRecorder()
+	if err := kami.JSON(resp, http.StatusCreated, map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != http.StatusCreated {
+		t.Error("should return HTTP StatusCreated(201)", resp.Code, "≠", http.StatusCreated)
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != "application/json" {
+		t.Error("unexpected Content-Type:", ct)
+	}
+	if body := resp.Body.String(); body != `{"id":1}`+"\n" {
+		t.Error("unexpected body:", body)
+	}
+
+	// unencodable values don't write anything
+	resp = httptest.NewRecorder()
+	if err := kami.JSON(resp, http.StatusOK, func() {}); err == nil {
+		t.Error("expected an error")
+	}
+	if resp.Body.Len() != 0 {
+		t.Error("nothing should be written:", resp.Body.String())
+	}
+}
+
+func TestSetJSONCodec(t *testing.T) {
+	defer kami.SetJSONCodec(nil, nil)
+
+	var marshaled, unmarshaled int
+	kami.SetJSONCodec(func(v interface{}) ([]byte, error) {
+		marshaled++
+		return json.Marshal(v)
+	}, func(data []byte, v interface{}) error {
+		unmarshaled++
+		return json.Unmarshal(data, v)
+	})
+
+	resp := httptest.NewRecorder()
+	kami.JSON(resp, http.StatusOK, "hello")
+	kami.Problem(resp, http.StatusTeapot, kami.ProblemDetails{})
+	var buf bytes.Buffer
+	enc := kami.NewJSONEncoder(&buf)
+	enc.Encode(1)
+	enc.Encode(2)
+	if marshaled != 4 {
+		t.Error("custom marshal should be used by all helpers, used", marshaled)
+	}
+	if buf.String() != "1\n2\n" {
+		t.Error("unexpected stream:", buf.String())
+	}
+
+	var v struct{ Name string }
+	req, err := http.NewRequest("POST", "/", strings.NewReader(`{"Name":"kami"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kami.BindJSON(req, &v); err != nil {
+		t.Fatal(err)
+	}
+	if unmarshaled != 1 || v.Name != "kami" {
+		t.Error("custom unmarshal should be used", unmarshaled, v)
+	}
+
+	// custom streaming encoders
+	var encoded int
+	kami.SetJSONEncoder(func(w io.Writer) kami.JSONEncoder {
+		encoded++
+		return json.NewEncoder(w)
+	})
+	kami.NewJSONEncoder(&buf).Encode(3)
+	if encoded != 1 {
+		t.Error("custom encoder should be used")
+	}
+}
@@ -1,7 +1,13 @@
 package kami
 
 import (
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/zenazn/goji/web/mutil"
@@ -12,134 +18,606 @@ import (
 type HandleFn func(context.Context, http.ResponseWriter, *http.Request)
 
 var (
-	// Context is the root "god object" from which every request's context will derive
+	// Context is the root "god object" from which every request's context will derive.
+	// A request's context is cancelled when the client disconnects, or when kami is done with the request.
 	Context = context.Background()
+	// ResetFunc will, if set, be called by Reset to make the new root Context, instead of using context.Background().
+	// This is handy for test suites that call Reset between tests but want a baseline context, such as one with a test database.
+	// Reset doesn't clear it.
+	ResetFunc func() context.Context
 
 	// PanicHandler will, if set, be called on panics.
 	// You can use kami.Exception(ctx) within the panic handler to get panic details.
+	// Its context has everything added by middleware that finished before the panic, such as RequestID's ID.
+	// It can respond with any status, such as 502 for an upstream error; if it doesn't write one, the status is 500.
+	// If LogHandler is set but PanicHandler isn't, panics are recovered and answered with a 500 error using ErrorRenderer.
+	// panic(http.ErrAbortHandler) is never recovered, so net/http can abort the response as usual.
 	PanicHandler HandleFn
 	// LogHandler will, if set, wrap every request and be called at the very end.
 	LogHandler func(context.Context, mutil.WriterProxy, *http.Request)
 )
 
-var routes = httprouter.New()
+var (
+	routes   = newRouter()
+	notFound httprouter.Handle
+	// methodNotAllowed is the router's 405 handler.
+	methodNotAllowed http.HandlerFunc
+	// registered lists every route, for Snapshot and Build.
+	registered []route
+)
+
+type route struct {
+	method string
+	path   string
+	handle httprouter.Handle
+	tags   Tags
+}
 
 func init() {
-	// set up the default 404 handler
+	// set up the default 404 and 405 handlers
 	NotFound(nil)
+	MethodNotAllowed(nil)
 }
 
 // Handler returns an http.Handler serving registered routes.
 func Handler() http.Handler {
-	return routes
+	return http.HandlerFunc(dispatch)
 }
 
 // Handle registers an arbitrary method handler under the given path.
-func Handle(method, path string, handle HandleFn) {
-	routes.Handle(method, path, bless(handle))
+// Optionally, middleware that only applies to this route can be given.
+// It will run in order, after all the middleware registered with Use.
+func Handle(method, path string, handle HandleFn, mw ...Middleware) {
+	register(method, path, bless(handle, true, path, mw, nil, false), nil)
+}
+
+// register adds a blessed handler to the router, unless registration is deferred.
+func register(method, path string, h httprouter.Handle, tags Tags) {
+	if !DeferRegistration {
+		routes.Handle(method, path, h)
+	}
+	registered = append(registered, route{method: method, path: path, handle: h, tags: tags})
+}
+
+// HandleSafe is like Handle, but returns an error instead of panicking if the route can't be registered.
+// This is useful for loading routes from plugins, where one bad route shouldn't crash the app.
+// The default router, httprouter, rejects routes that:
+//   - are already registered for the same method
+//   - don't begin with a slash
+//   - use a different parameter name at the same position as an existing route (/users/:id and /users/:name)
+//   - mix a static segment and a parameter at the same position (/users/new and /users/:id)
+//   - have a catch-all (*name) anywhere but the end, or alongside other routes at its position
+//   - have more than one parameter in a single segment
+func HandleSafe(method, path string, handle HandleFn, mw ...Middleware) error {
+	h := bless(handle, true, path, mw, nil, false)
+	if !DeferRegistration {
+		if err := addRoute(routes, route{method: method, path: path, handle: h}); err != nil {
+			return err
+		}
+	}
+	registered = append(registered, route{method: method, path: path, handle: h})
+	return nil
+}
+
+// HandleNoRecover is like Handle, but kami won't recover panics from the route's middleware or handler.
+// The panic carries on to net/http (which logs it and drops the connection) or whatever is serving kami,
+// skipping PanicHandler, OnPanicReport, afterware, and LogHandler.
+// Finalizers registered with Defer still run, and can see the panic with Exception.
+// This is meant for debugging, and for handlers that rely on net/http's own handling of panics.
+func HandleNoRecover(method, path string, handle HandleFn, mw ...Middleware) {
+	register(method, path, bless(handle, true, path, mw, nil, true), nil)
+}
+
+// GetNoRecover registers a GET handler that doesn't recover panics. See HandleNoRecover.
+func GetNoRecover(path string, handle HandleFn, mw ...Middleware) {
+	HandleNoRecover("GET", path, handle, mw...)
 }
 
-// Get registers a GET handler under the given path.
-func Get(path string, handle HandleFn) {
-	Handle("GET", path, handle)
+// Get registers a GET handler under the given path, with optional route middleware. See Handle.
+func Get(path string, handle HandleFn, mw ...Middleware) {
+	Handle("GET", path, handle, mw...)
 }
 
-// Post registers a POST handler under the given path.
-func Post(path string, handle HandleFn) {
-	Handle("POST", path, handle)
+// Post registers a POST handler under the given path, with optional route middleware. See Handle.
+func Post(path string, handle HandleFn, mw ...Middleware) {
+	Handle("POST", path, handle, mw...)
 }
 
-// Put registers a PUT handler under the given path.
-func Put(path string, handle HandleFn) {
-	Handle("PUT", path, handle)
+// Put registers a PUT handler under the given path, with optional route middleware. See Handle.
+func Put(path string, handle HandleFn, mw ...Middleware) {
+	Handle("PUT", path, handle, mw...)
 }
 
-// Patch registers a PATCH handler under the given path.
-func Patch(path string, handle HandleFn) {
-	Handle("PATCH", path, handle)
+// Patch registers a PATCH handler under the given path, with optional route middleware. See Handle.
+func Patch(path string, handle HandleFn, mw ...Middleware) {
+	Handle("PATCH", path, handle, mw...)
 }
 
-// Head registers a HEAD handler under the given path.
-func Head(path string, handle HandleFn) {
-	Handle("HEAD", path, handle)
+// Head registers a HEAD handler under the given path, with optional route middleware. See Handle.
+func Head(path string, handle HandleFn, mw ...Middleware) {
+	Handle("HEAD", path, handle, mw...)
 }
 
-// Delete registers a DELETE handler under the given path.
-func Delete(path string, handle HandleFn) {
-	Handle("DELETE", path, handle)
+// Delete registers a DELETE handler under the given path, with optional route middleware. See Handle.
+func Delete(path string, handle HandleFn, mw ...Middleware) {
+	Handle("DELETE", path, handle, mw...)
+}
+
+// HandleIf is like Handle, but only registers the route if cond is true.
+// This is handy for things like debug endpoints that should only exist in development.
+// If cond is false, nothing is registered, so requests for the path get the NotFound handler.
+func HandleIf(cond bool, method, path string, handle HandleFn, mw ...Middleware) {
+	if cond {
+		Handle(method, path, handle, mw...)
+	}
+}
+
+// GetIf registers a GET handler under the given path if cond is true. See HandleIf.
+func GetIf(cond bool, path string, handle HandleFn, mw ...Middleware) {
+	HandleIf(cond, "GET", path, handle, mw...)
+}
+
+// PostIf registers a POST handler under the given path if cond is true. See HandleIf.
+func PostIf(cond bool, path string, handle HandleFn, mw ...Middleware) {
+	HandleIf(cond, "POST", path, handle, mw...)
+}
+
+// PutIf registers a PUT handler under the given path if cond is true. See HandleIf.
+func PutIf(cond bool, path string, handle HandleFn, mw ...Middleware) {
+	HandleIf(cond, "PUT", path, handle, mw...)
+}
+
+// PatchIf registers a PATCH handler under the given path if cond is true. See HandleIf.
+func PatchIf(cond bool, path string, handle HandleFn, mw ...Middleware) {
+	HandleIf(cond, "PATCH", path, handle, mw...)
+}
+
+// HeadIf registers a HEAD handler under the given path if cond is true. See HandleIf.
+func HeadIf(cond bool, path string, handle HandleFn, mw ...Middleware) {
+	HandleIf(cond, "HEAD", path, handle, mw...)
+}
+
+// DeleteIf registers a DELETE handler under the given path if cond is true. See HandleIf.
+func DeleteIf(cond bool, path string, handle HandleFn, mw ...Middleware) {
+	HandleIf(cond, "DELETE", path, handle, mw...)
+}
+
+// HandleMany registers the same handler for the given method under each of the given paths.
+// Like HandleSafe, it won't panic if a path conflicts with an existing route.
+// Instead, the other paths are still registered, and the returned error is RegisterErrors listing each failure.
+func HandleMany(method string, paths []string, handle HandleFn) error {
+	var errs RegisterErrors
+	for _, path := range paths {
+		if err := HandleSafe(method, path, handle); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// GetMany registers a GET handler under each of the given paths. See HandleMany.
+func GetMany(paths []string, handle HandleFn) error {
+	return HandleMany("GET", paths, handle)
+}
+
+// PostMany registers a POST handler under each of the given paths. See HandleMany.
+func PostMany(paths []string, handle HandleFn) error {
+	return HandleMany("POST", paths, handle)
+}
+
+// PutMany registers a PUT handler under each of the given paths. See HandleMany.
+func PutMany(paths []string, handle HandleFn) error {
+	return HandleMany("PUT", paths, handle)
+}
+
+// PatchMany registers a PATCH handler under each of the given paths. See HandleMany.
+func PatchMany(paths []string, handle HandleFn) error {
+	return HandleMany("PATCH", paths, handle)
+}
+
+// HeadMany registers a HEAD handler under each of the given paths. See HandleMany.
+func HeadMany(paths []string, handle HandleFn) error {
+	return HandleMany("HEAD", paths, handle)
+}
+
+// DeleteMany registers a DELETE handler under each of the given paths. See HandleMany.
+func DeleteMany(paths []string, handle HandleFn) error {
+	return HandleMany("DELETE", paths, handle)
+}
+
+// anyMethods are the methods registered by Any.
+var anyMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// Any registers a handler for every standard method (GET, HEAD, POST, PUT, PATCH, DELETE, and OPTIONS) under the given path.
+// Methods that are already registered for the path are left alone, and the returned error is RegisterErrors listing them.
+func Any(path string, handle HandleFn, mw ...Middleware) error {
+	return AnyExcept(nil, path, handle, mw...)
+}
+
+// AnyExcept is like Any, but skips the given methods.
+// Requests for skipped methods will get 405 Method Not Allowed, unless they are registered separately.
+func AnyExcept(except []string, path string, handle HandleFn, mw ...Middleware) error {
+	var errs RegisterErrors
+outer:
+	for _, method := range anyMethods {
+		for _, skip := range except {
+			if strings.EqualFold(method, skip) {
+				continue outer
+			}
+		}
+		if err := HandleSafe(method, path, handle, mw...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// RegisterErrors is a list of errors from registering multiple routes.
+type RegisterErrors []error
+
+func (errs RegisterErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Cancel cancels the context of the current request, and every context derived from it.
+// Use it to stop background work tied to the request, for example after responding early.
+// kami cancels every request's context once it is done with it, so calling Cancel is never required.
+// Cancel does nothing if ctx didn't come from kami.
+func Cancel(ctx context.Context) {
+	if req := requestFrom(ctx); req != nil {
+		req.cancel()
+	}
+}
+
+// requestSeq is the sequence number of the last request.
+var requestSeq uint64
+
+// Seq returns the request's sequence number, which starts at 1 and goes up by one with every request kami handles.
+// It can be logged to tell the order requests arrived in.
+// Sequence numbers are only unique within a process, and start over when it restarts.
+// Seq returns 0 if ctx didn't come from kami.
+func Seq(ctx context.Context) uint64 {
+	if req := requestFrom(ctx); req != nil {
+		return req.seq
+	}
+	return 0
+}
+
+// StartTime returns when kami started handling the request, before any middleware ran.
+// It returns the zero time if ctx didn't come from kami.
+func StartTime(ctx context.Context) time.Time {
+	if req := requestFrom(ctx); req != nil {
+		return req.start
+	}
+	return time.Time{}
+}
+
+// Matched returns true if the request matched a registered route,
+// or false if it's being handled by NotFound or a Fallback.
+func Matched(ctx context.Context) bool {
+	req := requestFrom(ctx)
+	return req != nil && req.matched
+}
+
+// Lookup returns the handler registered for the given method and path, along with the URL parameters.
+// It doesn't run the handler or any middleware.
+// If no route matches (meaning the request would be handled by NotFound), it returns false.
+func Lookup(method, path string) (HandleFn, httprouter.Params, bool) {
+	h, params, ok := routes.Lookup(method, path)
+	if !ok {
+		return nil, nil, false
+	}
+	// ask the blessed handler what it wraps
+	var lw lookupWriter
+	h(&lw, nil, params)
+	if lw.handler == nil {
+		return nil, nil, false
+	}
+	return lw.handler, params, true
+}
+
+// lookupWriter is passed to blessed handlers by Lookup to retrieve the original handler.
+type lookupWriter struct {
+	http.ResponseWriter
+	handler HandleFn
 }
 
 // NotFound registers a special handler for unregistered (404) paths.
-// If handle is nil, use the default http.NotFound behavior.
+// If handle is nil, the default handler responds using ErrorRenderer.
+// See Fallback for handling unregistered paths under a prefix.
 func NotFound(handle HandleFn) {
 	// set up the default handler if needed
 	// we need to bless this so middleware will still run for a 404 request
 	if handle == nil {
-		handle = func(_ context.Context, w http.ResponseWriter, r *http.Request) {
-			http.NotFound(w, r)
+		handle = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			renderError(ctx, w, r, http.StatusNotFound)
 		}
 	}
 
-	h := bless(handle)
-	routes.NotFound = func(w http.ResponseWriter, r *http.Request) {
-		h(w, r, nil)
+	notFound = bless(handle, false, "", nil, nil, false)
+	routes.NotFound(http.HandlerFunc(handleNotFound))
+}
+
+// MethodNotAllowed registers a special handler for paths that are registered, but not for the request's method (405).
+// If handle is nil, the default handler responds using ErrorRenderer.
+// Unlike a handler given here, the default doesn't run any middleware, just like httprouter's.
+func MethodNotAllowed(handle HandleFn) {
+	if handle == nil {
+		methodNotAllowed = func(w http.ResponseWriter, r *http.Request) {
+			renderError(Context, w, r, http.StatusMethodNotAllowed)
+		}
+	} else {
+		h := bless(handle, false, "", nil, nil, false)
+		methodNotAllowed = func(w http.ResponseWriter, r *http.Request) {
+			h(w, r, nil)
+		}
 	}
+	routes.MethodNotAllowed(methodNotAllowed)
 }
 
 // bless is the meat of kami.
 // It wraps a HandleFn into an httprouter compatible request,
 // in order to run all the middleware and other special handlers.
-func bless(k HandleFn) httprouter.Handle {
+// matched is false for the NotFound handler.
+// inline is middleware for this route in particular, registered under the given route path.
+// tags are the route's tags, for RouteTags.
+// If noRecover is true, panics aren't recovered (see HandleNoRecover).
+func bless(k HandleFn, matched bool, route string, inline []Middleware, tags Tags, noRecover bool) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-		ctx := Context
+		if lw, ok := w.(*lookupWriter); ok {
+			lw.handler = k
+			return
+		}
+
+		ctx, cancel := context.WithCancel(Context)
+		defer cancel()
+		// the root Context doesn't come from r.Context, so pass on client disconnects
+		if disconnected := r.Context().Done(); disconnected != nil {
+			done := ctx.Done()
+			go func() {
+				select {
+				case <-disconnected:
+					cancel()
+				case <-done:
+				}
+			}()
+		}
 		if len(params) > 0 {
-			ctx = newContextWithParams(Context, params)
+			ctx = newContextWithParams(ctx, params)
 		}
-		ranLogHandler := false // track this in case the log handler blows up
+		req := &request{matched: matched, cancel: cancel, seq: atomic.AddUint64(&requestSeq, 1), start: time.Now(), tags: tags, route: route, url: r.URL, r: r}
+		if orig, ok := r.Context().Value(originalPathKey).(string); ok {
+			req.originalPath = orig
+		}
+		ctx = newContextWithRequest(ctx, req)
+		defer req.finish()
+		// track these in case afterware or the log handler blows up
+		ranAfterware := false
+		ranLogHandler := false
 
 		writer := w
 		var proxy mutil.WriterProxy
-		if LogHandler != nil {
-			proxy = mutil.WrapWriter(w)
+		if LogHandler != nil || len(afterware) > 0 {
+			proxy = wrapWriter(w, req)
 			writer = proxy
 		}
 
-		if PanicHandler != nil {
+		if noRecover {
+			defer func() {
+				if err := recover(); err != nil {
+					// for finalizers
+					req.exception = err
+					panic(err)
+				}
+			}()
+		} else if PanicHandler != nil || LogHandler != nil || OnPanicReport != nil {
 			defer func() {
 				if err := recover(); err != nil {
+					if err == http.ErrAbortHandler {
+						// an intentional abort: let net/http quietly drop the connection
+						panic(err)
+					}
+					req.exception = err
+					if req.ctx != nil {
+						ctx = req.ctx
+					}
 					ctx = newContextWithException(ctx, err)
-					PanicHandler(ctx, writer, r)
+					if OnPanicReport != nil {
+						OnPanicReport(newPanicReport(ctx, err, writer, r))
+					}
+					req.closeWriters()
+					if PanicHandler != nil {
+						PanicHandler(ctx, writer, r)
+						// the panic handler can pick its own status, but if it didn't write one,
+						// it's a 500, and afterware and LogHandler should see that too
+						if proxy != nil && !req.hijacked && !headerWritten(proxy) {
+							proxy.WriteHeader(http.StatusInternalServerError)
+						}
+					} else if !req.hijacked {
+						// no panic handler, but we still want to log this as an error
+						renderError(ctx, writer, r, http.StatusInternalServerError)
+					}
+
+					if len(afterware) > 0 && !ranAfterware {
+						ctx = runAfter(ctx, proxy, r)
+					}
 
 					if LogHandler != nil && !ranLogHandler {
 						LogHandler(ctx, proxy, r)
-						// should only happen if header hasn't been written
-						proxy.WriteHeader(http.StatusInternalServerError)
 					}
 				}
 			}()
 		}
 
-		ctx, ok := run(ctx, writer, r)
+		req.writer = writer
+		req.root = writer
+		ok := true
+		if len(outermost) > 0 {
+			ctx, ok = runChain(ctx, req, r, "", outermost)
+		}
 		if ok {
-			k(ctx, writer, r)
+			ctx, ok = run(ctx, req, r)
+		}
+		if ok && len(inline) > 0 {
+			ctx, ok = runChain(ctx, req, r, route, inline)
+		}
+		if ok && len(innermost) > 0 {
+			ctx, ok = runChain(ctx, req, r, "", innermost)
+		}
+		if ok {
+			if timelineEnabled {
+				start := time.Now()
+				k(ctx, req.writer, r)
+				req.addSpan(SpanHandler, route, k, start)
+			} else {
+				k(ctx, req.writer, r)
+			}
+		}
+		req.closeWriters()
+
+		if len(afterware) > 0 {
+			ranAfterware = true
+			ctx = runAfter(ctx, proxy, r)
 		}
 
 		if LogHandler != nil {
 			ranLogHandler = true
 			LogHandler(ctx, proxy, r)
 			// should only happen if header hasn't been written
-			proxy.WriteHeader(http.StatusInternalServerError)
+			if !req.hijacked {
+				proxy.WriteHeader(http.StatusInternalServerError)
+			}
 		}
 	}
 }
 
-// Reset changes the root Context to context.Background().
-// It removes every handler and all middleware.
+// Reset changes the root Context to context.Background(), or what ResetFunc returns if it's set.
+// It removes every handler, fallback, and all middleware and afterware, and clears the base path.
 func Reset() {
 	Context = context.Background()
+	if ResetFunc != nil {
+		Context = ResetFunc()
+	}
 	PanicHandler = nil
 	LogHandler = nil
+	OnPanicReport = nil
 	middleware = make(map[string][]Middleware)
-	routes = httprouter.New()
+	afterware = make(map[string][]Afterware)
+	outermost = nil
+	innermost = nil
+	basePath = ""
+	rewriters = nil
+	docs = make(map[string]RouteDoc)
+	APIInfo = OpenAPIInfo{Title: "API", Version: "1.0.0"}
+	fallbacks = make(map[string]httprouter.Handle)
+	newRouter = NewHTTPRouter
+	routes = newRouter()
+	registered = nil
+	DeferRegistration = false
+	ErrorRenderer = RenderError
+	ErrorStatus = DefaultErrorStatus
+	errorMappings = nil
+	ErrorBagRenderer = WriteFieldErrors
+	templates = nil
+	timelineEnabled = false
 	NotFound(nil)
+	MethodNotAllowed(nil)
+}
+
+// Defer registers fn to run when the current request is done, just before kami is finished with it.
+// Finalizers run after the handler, afterware, and LogHandler, even if the request panicked.
+// A finalizer can use kami.Exception with any context from the request to tell if it panicked.
+// They are run in reverse order of registration, like defer.
+// A panic inside of a finalizer won't be recovered by kami.
+// Defer does nothing if ctx didn't come from kami.
+func Defer(ctx context.Context, fn func()) {
+	if req := requestFrom(ctx); req != nil {
+		req.addFinalizer(fn)
+	}
+}
+
+// request holds kami's mutable state for a single request.
+type request struct {
+	// matched is true if a route was found for the request.
+	matched bool
+	// cancel cancels the request's context.
+	cancel context.CancelFunc
+	// finalizers are functions to run when the request is done, even if it panicked.
+	finalizers []func()
+	// exception is the recovered panic, if any.
+	exception interface{}
+	// timings are Server-Timing metrics.
+	timings []timing
+	// spans are the timeline, if EnableTimeline was called.
+	spans []Span
+	// marks are names recorded by MarkRan.
+	marks []string
+	// writer is the current response writer, which middleware can replace with SetWriter.
+	writer http.ResponseWriter
+	// root is the writer from before any SetWriter, for Push and Hijack.
+	root http.ResponseWriter
+	// closers are writers given to SetWriter that need to be closed after the handler.
+	closers []io.Closer
+	// status is the status hint from SetStatus.
+	status int
+	// seq is the request's sequence number.
+	seq uint64
+	// hijacked is true once the connection has been hijacked.
+	hijacked bool
+	// start is when kami started handling the request.
+	start time.Time
+	// tags are the matched route's tags.
+	tags Tags
+	// captured is the response body from CaptureBody.
+	captured *captureWriter
+	// route is the pattern of the matched route, and url is the request's URL, for RawParam.
+	route string
+	url   *url.URL
+	// r is the request, for ClientError.
+	r *http.Request
+	// nonce is the request's Nonce, made the first time it's asked for.
+	nonce     string
+	nonceOnce sync.Once
+	// originalPath is the path from before Rewrite, if there were rewrites.
+	originalPath string
+	// errors is the request's ErrorBag, also made on demand.
+	errors     *ErrorBag
+	errorsOnce sync.Once
+	// memo holds values from Memoize.
+	memo   map[string]*memoEntry
+	memoMu sync.Mutex
+	// ctx is the latest context returned by middleware or afterware,
+	// so a panic in the middle of a chain still sees what earlier middleware added.
+	ctx context.Context
+}
+
+// addFinalizer schedules fn to run when the request is done.
+func (req *request) addFinalizer(fn func()) {
+	req.finalizers = append(req.finalizers, fn)
+}
+
+// closeWriters closes writers given to SetWriter, innermost first.
+func (req *request) closeWriters() {
+	closers := req.closers
+	req.closers = nil
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i].Close()
+	}
+}
+
+// finish runs the finalizers in reverse order of registration.
+func (req *request) finish() {
+	for i := len(req.finalizers) - 1; i >= 0; i-- {
+		req.finalizers[i]()
+	}
 }
@@ -1,11 +1,17 @@
 package kami_test
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/zenazn/goji/web/mutil"
 	"golang.org/x/net/context"
@@ -57,6 +63,57 @@ func TestParams(t *testing.T) {
 	}
 }
 
+func TestRawParam(t *testing.T) {
+	kami.Reset()
+	kami.Get("/users/:name/files/*path", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, kami.Param(ctx, "name")+"|"+kami.RawParam(ctx, "name")+"|"+
+			kami.Param(ctx, "path")+"|"+kami.RawParam(ctx, "path")+"|"+kami.RawParam(ctx, "missing"))
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/users/J%C3%BCrgen%20K/files/a%2Fb/c%3Fd", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	want := "Jürgen K|J%C3%BCrgen%20K|/a/b/c?d|/a%2Fb/c%3Fd|"
+	if body := resp.Body.String(); body != want {
+		t.Error("unexpected params:", body, "≠", want)
+	}
+}
+
+func TestParamsFrom(t *testing.T) {
+	kami.Reset()
+	kami.Get("/users/:id/posts/:post", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		params := kami.ParamsFrom(ctx)
+		if len(params) != 2 || params[0].Key != "id" || params[1].Key != "post" {
+			t.Error("unexpected params:", params)
+		}
+		io.WriteString(w, kami.ParamByIndex(ctx, 0)+","+kami.ParamByIndex(ctx, 1)+","+kami.ParamByIndex(ctx, 2))
+	})
+	kami.Get("/none", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if params := kami.ParamsFrom(ctx); params != nil {
+			t.Error("expected no params, got", params)
+		}
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/users/1/posts/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if body := resp.Body.String(); body != "1,2," {
+		t.Error("unexpected body:", body)
+	}
+
+	req, err = http.NewRequest("GET", "/none", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(httptest.NewRecorder(), req)
+}
+
 func TestLoggerAndPanic(t *testing.T) {
 	kami.Reset()
 	// test logger with panic
@@ -109,6 +166,163 @@ func TestLoggerAndPanic(t *testing.T) {
 	}
 }
 
+func TestPanicHandlerStatus(t *testing.T) {
+	kami.Reset()
+	logged := 0
+	aftered := 0
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		logged = w.Status()
+	}
+	kami.After("/", func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+		aftered = w.Status()
+		return ctx
+	})
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if kami.Exception(ctx) == "upstream" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}
+	kami.Get("/upstream", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("upstream")
+	})
+	kami.Get("/other", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("other")
+	})
+
+	for path, want := range map[string]int{"/upstream": http.StatusBadGateway, "/other": http.StatusInternalServerError} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != want {
+			t.Error("unexpected status for", path, resp.Code, "≠", want)
+		}
+		if logged != want || aftered != want {
+			t.Error("afterware and LogHandler should see the same status for", path, aftered, logged, "≠", want)
+		}
+	}
+}
+
+func TestLoggerWithoutPanicHandler(t *testing.T) {
+	kami.Reset()
+	status := 0
+	var exception interface{}
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		status = w.Status()
+		exception = kami.Exception(ctx)
+	}
+	kami.Get("/test", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("test panic")
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusInternalServerError {
+		t.Error("should return HTTP StatusInternalServerError(500)", resp.Code, "≠", http.StatusInternalServerError)
+	}
+	if status != http.StatusInternalServerError {
+		t.Error("should log HTTP StatusInternalServerError(500)", status, "≠", http.StatusInternalServerError)
+	}
+	if exception != "test panic" {
+		t.Error("unexpected exception:", exception)
+	}
+}
+
+func TestAbortHandler(t *testing.T) {
+	kami.Reset()
+	var panicked, logged, finished bool
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panicked = true
+	}
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		logged = true
+	}
+	kami.Get("/abort", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Defer(ctx, func() { finished = true })
+		panic(http.ErrAbortHandler)
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/abort", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Error("http.ErrAbortHandler should reach the server, got", v)
+			}
+		}()
+		kami.Handler().ServeHTTP(resp, req)
+	}()
+	if panicked || logged {
+		t.Error("aborts shouldn't be handled as panics", panicked, logged)
+	}
+	if !finished {
+		t.Error("finalizers should still run")
+	}
+	if resp.Code == http.StatusInternalServerError {
+		t.Error("aborts shouldn't respond with a 500 error")
+	}
+}
+
+func TestGetNoRecover(t *testing.T) {
+	kami.Reset()
+	var panicked, logged bool
+	var exception interface{}
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panicked = true
+	}
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		logged = true
+	}
+	kami.GetNoRecover("/crash", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Defer(ctx, func() { exception = kami.Exception(ctx) })
+		panic("crash")
+	})
+	kami.Get("/recovered", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("recovered")
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/crash", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if v := recover(); v != "crash" {
+				t.Error("panic should propagate past kami, got", v)
+			}
+		}()
+		kami.Handler().ServeHTTP(resp, req)
+	}()
+	if panicked || logged {
+		t.Error("PanicHandler and LogHandler should be bypassed", panicked, logged)
+	}
+	if exception != "crash" {
+		t.Error("finalizers should see the panic, got", exception)
+	}
+
+	// other routes are still recovered
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/recovered", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if !panicked {
+		t.Error("PanicHandler should handle other routes")
+	}
+}
+
 func TestPanickingLogger(t *testing.T) {
 	kami.Reset()
 	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
@@ -164,6 +378,166 @@ func TestNotFound(t *testing.T) {
 	}
 }
 
+func TestCancel(t *testing.T) {
+	kami.Reset()
+	stopped := make(chan error, 1)
+	var reqCtx context.Context
+	kami.Get("/early", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		reqCtx = ctx
+		started := make(chan struct{})
+		go func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			stopped <- ctx.Err()
+		}(context.WithValue(ctx, "child", true))
+		<-started
+		io.WriteString(w, "cache hit")
+		kami.Cancel(ctx)
+		select {
+		case err := <-stopped:
+			if err != context.Canceled {
+				t.Error("unexpected error:", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("background work wasn't cancelled")
+		}
+	})
+	kami.Get("/normal", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		reqCtx = ctx
+		if ctx.Err() != nil {
+			t.Error("context shouldn't be cancelled yet")
+		}
+	})
+
+	for _, path := range []string{"/early", "/normal"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		if reqCtx.Err() != context.Canceled {
+			t.Error("context should be cancelled after the request:", path)
+		}
+	}
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	kami.Reset()
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	kami.Get("/slow", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-ctx.Done():
+			stopped <- ctx.Err()
+		case <-time.After(time.Second):
+			stopped <- nil
+		}
+	})
+
+	clientCtx, disconnect := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", "/slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan struct{})
+	go func() {
+		kami.Handler().ServeHTTP(httptest.NewRecorder(), req.WithContext(clientCtx))
+		close(served)
+	}()
+	<-started
+	disconnect()
+	if err := <-stopped; err != context.Canceled {
+		t.Error("context should be cancelled when the client disconnects, got", err)
+	}
+	<-served
+}
+
+func TestSeq(t *testing.T) {
+	kami.Reset()
+	seqs := make(chan uint64, 100)
+	kami.Get("/seq", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		seqs <- kami.Seq(ctx)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < cap(seqs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/seq", nil)
+			kami.Handler().ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	wg.Wait()
+	close(seqs)
+
+	seen := make(map[uint64]bool)
+	var min, max uint64
+	for seq := range seqs {
+		if seq == 0 || seen[seq] {
+			t.Error("sequence numbers should be unique and non-zero:", seq)
+		}
+		seen[seq] = true
+		if min == 0 || seq < min {
+			min = seq
+		}
+		if seq > max {
+			max = seq
+		}
+	}
+	if max-min != uint64(len(seen)-1) {
+		t.Error("sequence numbers should be consecutive:", min, max, len(seen))
+	}
+
+	// later requests get higher numbers
+	var next uint64
+	kami.Get("/next", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		next = kami.Seq(ctx)
+	})
+	req, _ := http.NewRequest("GET", "/next", nil)
+	kami.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if next <= max {
+		t.Error("sequence numbers should increase:", next, "≤", max)
+	}
+	if seq := kami.Seq(context.Background()); seq != 0 {
+		t.Error("expected 0 outside of kami, got", seq)
+	}
+}
+
+func TestMatched(t *testing.T) {
+	kami.Reset()
+	var matched []bool
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		matched = append(matched, kami.Matched(ctx))
+		return ctx
+	})
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		matched = append(matched, kami.Matched(ctx))
+	}
+	kami.Get("/hello", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, path := range []string{"/hello", "/missing"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+	}
+
+	expect := []bool{true, true, false, false}
+	if !reflect.DeepEqual(matched, expect) {
+		t.Error("unexpected matches", matched, "≠", expect)
+	}
+	if kami.Matched(context.Background()) {
+		t.Error("a context that didn't come from kami shouldn't be matched")
+	}
+}
+
 func TestNotFoundDefault(t *testing.T) {
 	kami.Reset()
 
@@ -179,4 +553,773 @@ func TestNotFoundDefault(t *testing.T) {
 	}
 }
 
+func TestHalt(t *testing.T) {
+	kami.Reset()
+	status := 0
+	var maintenance interface{}
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		status = w.Status()
+		maintenance = ctx.Value("maintenance")
+	}
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		ctx = context.WithValue(ctx, "maintenance", true)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "down for maintenance")
+		return kami.Halt(ctx)
+	})
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		t.Error("middleware should not run after halt")
+		return ctx
+	})
+	kami.Get("/hello", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not run after halt")
+	})
+
+	for _, path := range []string{"/hello", "/missing"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != http.StatusServiceUnavailable {
+			t.Error("should return HTTP StatusServiceUnavailable(503)", resp.Code, "≠", http.StatusServiceUnavailable)
+		}
+		if status != http.StatusServiceUnavailable {
+			t.Error("should log HTTP StatusServiceUnavailable(503)", status, "≠", http.StatusServiceUnavailable)
+		}
+		if maintenance != true {
+			t.Error("log handler should receive the halted context")
+		}
+	}
+}
+
+func TestAfterware(t *testing.T) {
+	kami.Reset()
+	var order []string
+	after := func(name string) kami.Afterware {
+		return func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+			order = append(order, name)
+			if w.Status() != http.StatusTeapot {
+				t.Error("afterware should see the handler's status", w.Status())
+			}
+			return context.WithValue(ctx, "after", name)
+		}
+	}
+	kami.After("/", after("root"))
+	kami.After("/a/", after("a1"))
+	kami.After("/a/", after("a2"))
+	kami.After("/a/b", func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+		order = append(order, "b")
+		return nil
+	})
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		if ctx.Value("after") != "root" {
+			t.Error("log handler should get the afterware context", ctx.Value("after"))
+		}
+	}
+	kami.Get("/a/b", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/a/b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusTeapot {
+		t.Error("should return HTTP StatusTeapot(418)", resp.Code, "≠", http.StatusTeapot)
+	}
+	expect := []string{"b", "a1", "a2", "root"}
+	if !reflect.DeepEqual(order, expect) {
+		t.Error("unexpected afterware order", order, "≠", expect)
+	}
+}
+
+func TestOnStatus(t *testing.T) {
+	kami.Reset()
+	var fired []int
+	kami.After("/", kami.OnStatus(func(status int) bool {
+		return status >= 400
+	}, func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+		fired = append(fired, w.Status())
+		return ctx
+	}))
+	kami.Get("/ok", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	kami.Get("/error", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for _, path := range []string{"/ok", "/error", "/missing"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+	}
+
+	expect := []int{http.StatusInternalServerError, http.StatusNotFound}
+	if !reflect.DeepEqual(fired, expect) {
+		t.Error("unexpected statuses", fired, "≠", expect)
+	}
+}
+
+func TestHaltedBy(t *testing.T) {
+	kami.Reset()
+	var info kami.HaltInfo
+	halted := false
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		info, halted = kami.HaltedBy(ctx)
+	}
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		return ctx
+	})
+	kami.Use("/private/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		return ctx
+	})
+	kami.Use("/private/", authMiddleware)
+	kami.Get("/private/data", noop)
+	kami.Get("/public", noop)
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/private/data", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Error("should return HTTP StatusUnauthorized(401)", resp.Code, "≠", http.StatusUnauthorized)
+	}
+	if !halted {
+		t.Fatal("request should be halted")
+	}
+	if info.Path != "/private/" || info.Index != 1 || !strings.HasSuffix(info.Name, ".authMiddleware") {
+		t.Error("unexpected halt info:", info)
+	}
+
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/public", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if halted {
+		t.Error("request shouldn't be halted:", info)
+	}
+}
+
+func authMiddleware(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+	w.WriteHeader(http.StatusUnauthorized)
+	return nil
+}
+
+func TestContextKeys(t *testing.T) {
+	kami.Reset()
+	// try our best to collide with kami's keys
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		for i := 0; i < 10; i++ {
+			ctx = context.WithValue(ctx, i, "bad")
+		}
+		ctx = context.WithValue(ctx, "params", "bad")
+		ctx = context.WithValue(ctx, "panic", "bad")
+		return ctx
+	})
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if err := kami.Exception(ctx); err != "test panic" {
+			t.Error("unexpected exception:", err)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	kami.Get("/test/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if id := kami.Param(ctx, "id"); id != "42" {
+			t.Error("unexpected param:", id)
+		}
+		if err := kami.Exception(ctx); err != nil {
+			t.Error("unexpected exception:", err)
+		}
+		panic("test panic")
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/test/42", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusInternalServerError {
+		t.Error("should return HTTP StatusInternalServerError(500)", resp.Code, "≠", http.StatusInternalServerError)
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	kami.Reset()
+	var order []string
+	mark := func(name string) kami.Middleware {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+			order = append(order, name)
+			return ctx
+		}
+	}
+	logged := 0
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		logged++
+	}
+	kami.Use("/", mark("global"))
+	kami.Use("/admin/", mark("admin"))
+	kami.Get("/admin/secret", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}, mark("inline1"), authMiddleware, mark("inline2"))
+	kami.Get("/admin/open", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}, mark("inline1"), mark("inline2"))
+
+	expect := map[string][]string{
+		"/admin/secret": {"global", "admin", "inline1"},
+		"/admin/open":   {"global", "admin", "inline1", "inline2", "handler"},
+	}
+	for path, want := range expect {
+		order = nil
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if !reflect.DeepEqual(order, want) {
+			t.Error("unexpected order for", path, order, "≠", want)
+		}
+	}
+	if logged != 2 {
+		t.Error("log handler should run for every request", logged)
+	}
+
+	// inline middleware halts are reported with the route path
+	var info kami.HaltInfo
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		info, _ = kami.HaltedBy(ctx)
+	}
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/admin/secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Error("should return HTTP StatusUnauthorized(401)", resp.Code, "≠", http.StatusUnauthorized)
+	}
+	if info.Path != "/admin/secret" || info.Index != 1 {
+		t.Error("unexpected halt info:", info)
+	}
+}
+
+func TestOutermostInnermost(t *testing.T) {
+	kami.Reset()
+	var order []string
+	mark := func(name string) kami.Middleware {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+			order = append(order, name)
+			return ctx
+		}
+	}
+	after := func(name string) kami.Afterware {
+		return func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+			order = append(order, name)
+			return ctx
+		}
+	}
+	kami.Use("/admin/", mark("admin"))
+	kami.Use("/", mark("global"))
+	kami.UseInnermost(mark("inner1"))
+	kami.UseInnermost(mark("inner2"))
+	kami.UseOutermost(mark("outer1"))
+	kami.UseOutermost(mark("outer2"))
+	kami.After("/", after("after-global"))
+	kami.After("/admin/", after("after-admin"))
+	kami.Get("/admin/page", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}, mark("inline"))
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/admin/page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	want := []string{"outer1", "outer2", "global", "admin", "inline", "inner1", "inner2", "handler", "after-admin", "after-global"}
+	if !reflect.DeepEqual(order, want) {
+		t.Error("unexpected order:", order, "≠", want)
+	}
+
+	// halting outermost middleware skips everything but afterware
+	kami.UseOutermost(authMiddleware)
+	order = nil
+	resp = httptest.NewRecorder()
+	kami.Handler().ServeHTTP(resp, req)
+	want = []string{"outer1", "outer2", "after-admin", "after-global"}
+	if !reflect.DeepEqual(order, want) {
+		t.Error("unexpected order:", order, "≠", want)
+	}
+	if resp.Code != http.StatusUnauthorized {
+		t.Error("should return HTTP StatusUnauthorized(401)", resp.Code, "≠", http.StatusUnauthorized)
+	}
+}
+
+func TestUseWhen(t *testing.T) {
+	kami.Reset()
+	var order []string
+	mark := func(name string) kami.Middleware {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+			order = append(order, name)
+			return ctx
+		}
+	}
+	beta := func(r *http.Request) bool {
+		c, err := r.Cookie("beta")
+		return err == nil && c.Value == "1"
+	}
+	kami.Use("/", mark("first"))
+	kami.UseWhen(beta, mark("beta"))
+	kami.Use("/", mark("last"))
+	kami.Use("/admin/", kami.When(beta, mark("beta-admin")))
+	kami.Get("/admin/page", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	})
+	kami.Get("/page", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	})
+
+	tests := []struct {
+		path string
+		beta bool
+		want []string
+	}{
+		{"/page", true, []string{"first", "beta", "last", "handler"}},
+		{"/page", false, []string{"first", "last", "handler"}},
+		{"/admin/page", true, []string{"first", "beta", "last", "beta-admin", "handler"}},
+		{"/admin/page", false, []string{"first", "last", "handler"}},
+	}
+	for _, test := range tests {
+		order = nil
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.beta {
+			req.AddCookie(&http.Cookie{Name: "beta", Value: "1"})
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		if !reflect.DeepEqual(order, test.want) {
+			t.Error("unexpected order for", test.path, test.beta, order, "≠", test.want)
+		}
+	}
+}
+
+func TestGetIf(t *testing.T) {
+	kami.Reset()
+	kami.GetIf(true, "/debug/on", noop)
+	kami.GetIf(false, "/debug/off", noop)
+	kami.PostIf(false, "/debug/on", noop)
+
+	expect := []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/debug/on", http.StatusOK},
+		{"GET", "/debug/off", http.StatusNotFound},
+		{"POST", "/debug/on", http.StatusMethodNotAllowed},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(e.method, e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.method, e.path, resp.Code, "≠", e.status)
+		}
+	}
+	if _, _, ok := kami.Lookup("GET", "/debug/off"); ok {
+		t.Error("route shouldn't be registered")
+	}
+}
+
+func TestHandleSafe(t *testing.T) {
+	kami.Reset()
+	if err := kami.HandleSafe("GET", "/users/:id", noop); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	bad := []string{
+		"/users/:id",
+		"/users/:name",
+		"/users/new",
+		"/users/*all",
+		"no-slash",
+		"/files/*path/more",
+	}
+	for _, path := range bad {
+		err := kami.HandleSafe("GET", path, noop)
+		if err == nil {
+			t.Error("expected an error for", path)
+			continue
+		}
+		if !strings.Contains(err.Error(), path) {
+			t.Error("error should mention the path:", err)
+		}
+	}
+
+	// the original route still works
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/users/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	kami.Reset()
+	kami.Get("/taken", noop)
+	kami.Get("/users/:id", noop)
+
+	err := kami.GetMany([]string{"/old", "/taken", "/legacy/page", "/users/:name", "/new"}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "new")
+	})
+	errs, ok := err.(kami.RegisterErrors)
+	if !ok {
+		t.Fatal("expected RegisterErrors, got", err)
+	}
+	if len(errs) != 2 {
+		t.Error("expected 2 errors, got", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "/taken") || !strings.Contains(errs[1].Error(), "/users/:name") {
+		t.Error("errors should name the conflicting paths:", errs)
+	}
+
+	for _, path := range []string{"/old", "/legacy/page", "/new"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Body.String() != "new" {
+			t.Error("path not registered:", path, resp.Code)
+		}
+	}
+
+	if err := kami.PostMany([]string{"/a", "/b"}, noop); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestAnyExcept(t *testing.T) {
+	kami.Reset()
+	kami.Post("/resource", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "own post")
+	})
+	err := kami.AnyExcept([]string{"delete"}, "/resource", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "any")
+	})
+	errs, ok := err.(kami.RegisterErrors)
+	if !ok || len(errs) != 1 || !strings.Contains(errs[0].Error(), "POST") {
+		t.Error("expected a conflict for POST, got", err)
+	}
+
+	tests := map[string]struct {
+		code int
+		body string
+	}{
+		"GET":     {http.StatusOK, "any"},
+		"PUT":     {http.StatusOK, "any"},
+		"PATCH":   {http.StatusOK, "any"},
+		"OPTIONS": {http.StatusOK, "any"},
+		"POST":    {http.StatusOK, "own post"},
+		"DELETE":  {http.StatusMethodNotAllowed, ""},
+	}
+	for method, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(method, "/resource", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Error("unexpected status for", method, resp.Code, "≠", test.code)
+		}
+		if test.body != "" && resp.Body.String() != test.body {
+			t.Error("unexpected body for", method, resp.Body.String(), "≠", test.body)
+		}
+	}
+
+	if err := kami.Any("/everything", noop); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		t.Error("middleware shouldn't run")
+		return ctx
+	})
+	ran := false
+	kami.Get("/papers/:page", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ran = true
+	})
+
+	h, params, ok := kami.Lookup("GET", "/papers/3")
+	if !ok || h == nil {
+		t.Fatal("expected to find a handler")
+	}
+	if ran {
+		t.Error("handler shouldn't run during lookup")
+	}
+	if page := params.ByName("page"); page != "3" {
+		t.Error("unexpected page param:", page)
+	}
+	h(context.Background(), httptest.NewRecorder(), nil)
+	if !ran {
+		t.Error("lookup returned the wrong handler")
+	}
+
+	if _, _, ok := kami.Lookup("POST", "/papers/3"); ok {
+		t.Error("shouldn't find a POST handler")
+	}
+	if _, _, ok := kami.Lookup("GET", "/missing"); ok {
+		t.Error("shouldn't find a handler for /missing")
+	}
+}
+
+func TestExceptionString(t *testing.T) {
+	type custom struct {
+		Code int
+	}
+	tests := []struct {
+		panic  func()
+		expect string
+	}{
+		{func() { panic("test panic") }, "test panic"},
+		{func() { panic(errors.New("test error")) }, "test error"},
+		{func() { panic(custom{42}) }, "{42}"},
+		{func() {
+			var m map[string]int
+			m["crash"] = 1
+		}, "assignment to entry in nil map"},
+		{func() {
+			defer func() {
+				panic(fmt.Errorf("wrapped: %w", recover().(error)))
+			}()
+			var p *custom
+			_ = p.Code
+		}, "runtime error: invalid memory address or nil pointer dereference"},
+	}
+
+	for _, test := range tests {
+		kami.Reset()
+		got := "(not called)"
+		kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			got = kami.ExceptionString(ctx)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fn := test.panic
+		kami.Get("/test", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if msg := kami.ExceptionString(ctx); msg != "" {
+				t.Error("unexpected exception before panic:", msg)
+			}
+			fn()
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		if got != test.expect {
+			t.Error("unexpected exception string:", got, "≠", test.expect)
+		}
+	}
+}
+
+func TestExceptionAfterware(t *testing.T) {
+	kami.Reset()
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	var afterException, deferException interface{}
+	kami.After("/", func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+		afterException = kami.Exception(ctx)
+		return ctx
+	})
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		kami.Defer(ctx, func() {
+			deferException = kami.Exception(ctx)
+		})
+		return ctx
+	})
+	kami.Get("/ok", noop)
+	kami.Get("/panic", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("test panic")
+	})
+
+	expect := map[string]interface{}{
+		"/ok":    nil,
+		"/panic": "test panic",
+	}
+	for path, want := range expect {
+		afterException, deferException = "(not called)", "(not called)"
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if afterException != want {
+			t.Error("unexpected afterware exception for", path, afterException, "≠", want)
+		}
+		if deferException != want {
+			t.Error("unexpected finalizer exception for", path, deferException, "≠", want)
+		}
+	}
+}
+
+func TestDefer(t *testing.T) {
+	kami.Reset()
+	var order []string
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		order = append(order, "log")
+	}
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		order = append(order, "panic")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		kami.Defer(ctx, func() {
+			order = append(order, "middleware")
+		})
+		return ctx
+	})
+	kami.After("/", func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+		order = append(order, "after")
+		return ctx
+	})
+	kami.Get("/ok", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Defer(ctx, func() {
+			order = append(order, "handler")
+		})
+	})
+	kami.Get("/panic", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Defer(ctx, func() {
+			order = append(order, "handler")
+		})
+		panic("test panic")
+	})
+
+	expect := map[string][]string{
+		"/ok":    {"after", "log", "handler", "middleware"},
+		"/panic": {"panic", "after", "log", "handler", "middleware"},
+	}
+	for path, want := range expect {
+		order = nil
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if !reflect.DeepEqual(order, want) {
+			t.Error("unexpected order for", path, order, "≠", want)
+		}
+	}
+}
+
 func noop(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+
+func TestSubPath(t *testing.T) {
+	kami.Reset()
+	var got string
+	record := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		got = kami.SubPath(ctx)
+	}
+	kami.Get("/files/*filepath", record)
+	kami.Get("/users/:id/docs/*rest", record)
+	kami.Get("/users/:id", record)
+	kami.Fallback("/api/", record)
+	kami.NotFound(record)
+
+	expect := map[string]string{
+		"/files/a/b.txt":        "/a/b.txt",
+		"/files/":               "/",
+		"/users/1/docs/x/y%20z": "/x/y z",
+		"/users/1":              "",
+		"/api/missing/thing":    "/api/missing/thing",
+		"/nowhere":              "/nowhere",
+	}
+	for path, want := range expect {
+		got = "unset"
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		if got != want {
+			t.Error("unexpected SubPath for", path, got, "≠", want)
+		}
+	}
+}
+
+func TestResetFunc(t *testing.T) {
+	type dbKey struct{}
+	kami.ResetFunc = func() context.Context {
+		return context.WithValue(context.Background(), dbKey{}, "test db")
+	}
+	defer func() {
+		kami.ResetFunc = nil
+		kami.Reset()
+	}()
+
+	kami.Reset()
+	kami.Get("/db", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if db := ctx.Value(dbKey{}); db != "test db" {
+			t.Error("request context should come from ResetFunc, got", db)
+		}
+	})
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/db", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+
+	kami.Context = context.Background()
+	kami.Reset()
+	if db := kami.Context.Value(dbKey{}); db != "test db" {
+		t.Error("Reset should use ResetFunc every time, got", db)
+	}
+
+	kami.ResetFunc = nil
+	kami.Reset()
+	if db := kami.Context.Value(dbKey{}); db != nil {
+		t.Error("without ResetFunc, Reset should use context.Background(), got", db)
+	}
+}
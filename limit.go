@@ -0,0 +1,86 @@
+package kami
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// LimitOption configures Limit.
+type LimitOption func(*limiter)
+
+// LimitWait makes Limit wait up to timeout for a free slot before rejecting the request.
+// A timeout of zero waits until the request's context is done.
+func LimitWait(timeout time.Duration) LimitOption {
+	return func(l *limiter) {
+		l.wait = true
+		l.timeout = timeout
+	}
+}
+
+type limiter struct {
+	sem     chan struct{}
+	wait    bool
+	timeout time.Duration
+}
+
+// Limit returns middleware that caps the number of in-flight requests at n.
+// Register it under "/" for a global cap, or under a specific path for a per-route cap.
+// By default, requests over the cap are rejected immediately with 503 Service Unavailable.
+// Use LimitWait to wait for a slot instead.
+// Slots are released when the request is done, even if the handler panics.
+// Limit panics if n is less than 1, since every request would be rejected.
+func Limit(n int, opts ...LimitOption) Middleware {
+	if n < 1 {
+		panic("kami: Limit needs n of at least 1")
+	}
+	l := &limiter{sem: make(chan struct{}, n)}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if !l.acquire(ctx) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return nil
+		}
+		if req := requestFrom(ctx); req != nil {
+			req.addFinalizer(l.release)
+		} else {
+			// not running under kami, so there's nothing to hold the slot
+			l.release()
+		}
+		return ctx
+	}
+}
+
+func (l *limiter) acquire(ctx context.Context) bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if !l.wait {
+		return false
+	}
+
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *limiter) release() {
+	<-l.sem
+}
@@ -0,0 +1,109 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestLimit(t *testing.T) {
+	kami.Reset()
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	kami.Use("/fast/", kami.Limit(1))
+	kami.Use("/wait/", kami.Limit(1, kami.LimitWait(time.Second)))
+	kami.Use("/short/", kami.Limit(1, kami.LimitWait(10*time.Millisecond)))
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	block := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+	}
+	kami.Get("/fast/block", block)
+	kami.Get("/fast/panic", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("test panic")
+	})
+	kami.Get("/fast/ok", noop)
+	kami.Get("/wait/block", block)
+	kami.Get("/wait/ok", noop)
+	kami.Get("/short/block", block)
+	kami.Get("/short/ok", noop)
+
+	get := func(path string) int {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		return resp.Code
+	}
+	expect := func(path string, code int) {
+		if got := get(path); got != code {
+			t.Error("unexpected status for", path, got, "≠", code)
+		}
+	}
+
+	// fail fast
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		get("/fast/block")
+	}()
+	<-entered
+	expect("/fast/ok", http.StatusServiceUnavailable)
+	unblock <- struct{}{}
+	wg.Wait()
+	expect("/fast/ok", http.StatusOK)
+
+	// panics must release the slot
+	expect("/fast/panic", http.StatusInternalServerError)
+	expect("/fast/ok", http.StatusOK)
+
+	// wait for a slot
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		get("/wait/block")
+	}()
+	<-entered
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		unblock <- struct{}{}
+	}()
+	expect("/wait/ok", http.StatusOK)
+	wg.Wait()
+
+	// wait, but time out
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		get("/short/block")
+	}()
+	<-entered
+	expect("/short/ok", http.StatusServiceUnavailable)
+	unblock <- struct{}{}
+	wg.Wait()
+}
+
+func TestLimitInvalid(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Limit should panic for n =", n)
+				}
+			}()
+			kami.Limit(n)
+		}()
+	}
+}
@@ -0,0 +1,78 @@
+package kami
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+	"golang.org/x/text/language"
+)
+
+// LocaleSource returns a locale explicitly requested by the client, or a blank string.
+type LocaleSource func(*http.Request) string
+
+// LocaleQuery returns a LocaleSource that reads the given query parameter, such as ?lang=ja.
+func LocaleQuery(name string) LocaleSource {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// LocaleCookie returns a LocaleSource that reads the given cookie.
+func LocaleCookie(name string) LocaleSource {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// Locale returns middleware that resolves the best supported locale for every request.
+// Use kami.LocaleTag(ctx) to get the result.
+// Overrides are checked in the order given, and the first one that matches a supported tag wins.
+// Otherwise, the Accept-Language header is used.
+// If nothing matches, the first supported tag is used, so supported must not be empty.
+func Locale(supported []language.Tag, overrides ...LocaleSource) Middleware {
+	if len(supported) == 0 {
+		panic("kami: Locale needs at least one supported tag")
+	}
+	matcher := language.NewMatcher(supported)
+
+	match := func(tags ...language.Tag) (language.Tag, bool) {
+		_, i, conf := matcher.Match(tags...)
+		if conf == language.No {
+			return supported[0], false
+		}
+		return supported[i], true
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		for _, src := range overrides {
+			tag, err := language.Parse(src(r))
+			if err != nil {
+				continue
+			}
+			if best, ok := match(tag); ok {
+				return newContextWithLocale(ctx, best)
+			}
+		}
+
+		tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+		best, _ := match(tags...)
+		return newContextWithLocale(ctx, best)
+	}
+}
+
+// LocaleTag returns the locale chosen by the Locale middleware, or language.Und if it didn't run.
+func LocaleTag(ctx context.Context) language.Tag {
+	tag, ok := ctx.Value(localeKey).(language.Tag)
+	if !ok {
+		return language.Und
+	}
+	return tag
+}
+
+func newContextWithLocale(ctx context.Context, tag language.Tag) context.Context {
+	return context.WithValue(ctx, localeKey, tag)
+}
@@ -0,0 +1,56 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+	"golang.org/x/text/language"
+
+	"github.com/guregu/kami"
+)
+
+func TestLocale(t *testing.T) {
+	kami.Reset()
+	supported := []language.Tag{language.English, language.Japanese, language.French}
+	kami.Use("/", kami.Locale(supported, kami.LocaleQuery("lang"), kami.LocaleCookie("lang")))
+	kami.Get("/hello", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, kami.LocaleTag(ctx).String())
+	})
+
+	tests := []struct {
+		path   string
+		accept string
+		cookie string
+		expect string
+	}{
+		{"/hello", "", "", "en"},
+		{"/hello", "de-DE, ja;q=0.8", "", "ja"},
+		{"/hello", "fr-CA", "", "fr"},
+		{"/hello", "de", "", "en"},
+		{"/hello", "ja", "fr", "fr"},
+		{"/hello?lang=ja", "fr", "fr", "ja"},
+		{"/hello?lang=xx", "fr", "", "fr"},
+		{"/hello?lang=de", "", "ja", "ja"},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept-Language", test.accept)
+		}
+		if test.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "lang", Value: test.cookie})
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if got := resp.Body.String(); got != test.expect {
+			t.Error("unexpected locale for", test.path, test.accept, test.cookie, got, "≠", test.expect)
+		}
+	}
+}
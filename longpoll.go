@@ -0,0 +1,88 @@
+package kami
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrLongPollTimeout is returned by LongPoll when the timeout is reached before produce is done.
+var ErrLongPollTimeout = errors.New("kami: long poll timed out")
+
+// longPollKeepAlive is written every flushInterval to keep the connection from going idle.
+var longPollKeepAlive = []byte("\n")
+
+// LongPoll holds the response open for up to timeout, for long-polling endpoints.
+// produce is called in a loop on another goroutine: it should block until it has data, returning it and whether it's done.
+// Data is written and flushed as soon as it arrives, and a newline is written and flushed every flushInterval
+// so proxies don't close the connection for being idle.
+// LongPoll returns nil once produce is done, ErrLongPollTimeout if the timeout is reached,
+// or the context's error if ctx is cancelled or the client disconnects.
+// A timeout or flushInterval of 0 or less disables it.
+// If LongPoll returns while produce is still running, the result of that call is thrown away and produce isn't called again.
+func LongPoll(ctx context.Context, w http.ResponseWriter, timeout, flushInterval time.Duration, produce func() ([]byte, bool)) error {
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	type chunk struct {
+		data []byte
+		done bool
+	}
+	chunks := make(chan chunk)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			data, done := produce()
+			select {
+			case chunks <- chunk{data, done}:
+			case <-stop:
+				return
+			}
+			if done {
+				return
+			}
+		}
+	}()
+
+	var expired, tick <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	if flushInterval > 0 {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case c := <-chunks:
+			if len(c.data) > 0 {
+				if _, err := w.Write(c.data); err != nil {
+					return err
+				}
+				flush()
+			}
+			if c.done {
+				return nil
+			}
+		case <-tick:
+			if _, err := w.Write(longPollKeepAlive); err != nil {
+				return err
+			}
+			flush()
+		case <-expired:
+			return ErrLongPollTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
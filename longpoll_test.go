@@ -0,0 +1,102 @@
+package kami_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestLongPoll(t *testing.T) {
+	results := make(chan error, 1)
+	release := make(chan struct{})
+	defer close(release)
+	blocked := func() ([]byte, bool) {
+		<-release
+		return nil, true
+	}
+
+	kami.Reset()
+	kami.Get("/timeout", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		results <- kami.LongPoll(ctx, w, 100*time.Millisecond, 20*time.Millisecond, blocked)
+	})
+	kami.Get("/done", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		msgs := []string{"hello ", "world"}
+		results <- kami.LongPoll(ctx, w, time.Minute, time.Minute, func() ([]byte, bool) {
+			msg := msgs[0]
+			msgs = msgs[1:]
+			return []byte(msg), len(msgs) == 0
+		})
+	})
+	kami.Get("/hang", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		results <- kami.LongPoll(ctx, w, time.Minute, 10*time.Millisecond, blocked)
+	})
+
+	// timeout: keep-alives are sent until the time is up
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/timeout", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	kami.Handler().ServeHTTP(resp, req)
+	if err := <-results; err != kami.ErrLongPollTimeout {
+		t.Error("expected ErrLongPollTimeout, got", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Error("should return around the timeout, took", elapsed)
+	}
+	if n := strings.Count(resp.Body.String(), "\n"); n < 2 || strings.TrimSpace(resp.Body.String()) != "" {
+		t.Errorf("expected a few keep-alives, got %q", resp.Body.String())
+	}
+	if !resp.Flushed {
+		t.Error("keep-alives should be flushed")
+	}
+
+	// early done
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/done", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if err := <-results; err != nil {
+		t.Error("expected no error when produce is done, got", err)
+	}
+	if got := resp.Body.String(); got != "hello world" {
+		t.Error("unexpected body:", got)
+	}
+
+	// client disconnect
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err = http.NewRequest("GET", srv.URL+"/hang", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hresp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wait for a keep-alive, then hang up
+	if _, err := bufio.NewReader(hresp.Body).ReadByte(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	hresp.Body.Close()
+	select {
+	case err := <-results:
+		if err != context.Canceled {
+			t.Error("expected context.Canceled after the client disconnected, got", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("LongPoll should stop when the client disconnects")
+	}
+}
@@ -0,0 +1,25 @@
+package kami
+
+import (
+	"golang.org/x/net/context"
+)
+
+// MarkRan records that something, such as a piece of middleware, ran for the current request.
+// It's meant for tests that want to assert which middleware ran, using Ran.
+// MarkRan does nothing if ctx didn't come from kami.
+func MarkRan(ctx context.Context, name string) {
+	if req := requestFrom(ctx); req != nil {
+		req.marks = append(req.marks, name)
+	}
+}
+
+// Ran returns the names recorded by MarkRan for the current request, in order.
+func Ran(ctx context.Context) []string {
+	req := requestFrom(ctx)
+	if req == nil || len(req.marks) == 0 {
+		return nil
+	}
+	marks := make([]string, len(req.marks))
+	copy(marks, req.marks)
+	return marks
+}
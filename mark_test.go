@@ -0,0 +1,56 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestMarkRan(t *testing.T) {
+	kami.Reset()
+	auth := func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		kami.MarkRan(ctx, "auth")
+		return ctx
+	}
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		kami.MarkRan(ctx, "root")
+		return ctx
+	})
+	kami.Use("/private/", auth)
+	kami.Get("/private/data", noop)
+	kami.Get("/public", noop)
+	kami.Get("/inline", noop, auth)
+
+	var ran []string
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		ran = kami.Ran(ctx)
+	}
+
+	expect := map[string][]string{
+		"/private/data": {"root", "auth"},
+		"/public":       {"root"},
+		"/inline":       {"root", "auth"},
+	}
+	for path, want := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if !reflect.DeepEqual(ran, want) {
+			t.Error("unexpected middleware for", path, ran, "≠", want)
+		}
+	}
+
+	if ran := kami.Ran(context.Background()); ran != nil {
+		t.Error("nothing should have run:", ran)
+	}
+}
@@ -0,0 +1,43 @@
+package kami
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// memoEntry is a value computed by Memoize.
+type memoEntry struct {
+	once sync.Once
+	val  interface{}
+	err  error
+}
+
+// Memoize returns the result of compute, calling it only the first time it's asked for a given key during the current request.
+// Later calls with the same key, from any middleware, handler, or afterware of the request, get the same value and error,
+// so something like parsing the auth claims only happens once.
+// It's safe to call from multiple goroutines: if the value is being computed, other callers wait for it.
+// compute must not call Memoize with its own key.
+// If ctx didn't come from kami, compute is called every time.
+func Memoize(ctx context.Context, key string, compute func() (interface{}, error)) (interface{}, error) {
+	req := requestFrom(ctx)
+	if req == nil {
+		return compute()
+	}
+
+	req.memoMu.Lock()
+	if req.memo == nil {
+		req.memo = make(map[string]*memoEntry)
+	}
+	e, ok := req.memo[key]
+	if !ok {
+		e = new(memoEntry)
+		req.memo[key] = e
+	}
+	req.memoMu.Unlock()
+
+	e.once.Do(func() {
+		e.val, e.err = compute()
+	})
+	return e.val, e.err
+}
@@ -0,0 +1,76 @@
+package kami_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestMemoize(t *testing.T) {
+	calls := 0
+	claims := func(ctx context.Context) (interface{}, error) {
+		return kami.Memoize(ctx, "claims", func() (interface{}, error) {
+			calls++
+			return "user 42", nil
+		})
+	}
+	errBad := errors.New("bad token")
+	failCalls := 0
+	failing := func(ctx context.Context) error {
+		_, err := kami.Memoize(ctx, "failing", func() (interface{}, error) {
+			failCalls++
+			return nil, errBad
+		})
+		return err
+	}
+
+	kami.Reset()
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if v, _ := claims(ctx); v != "user 42" {
+			t.Error("unexpected value in middleware:", v)
+		}
+		failing(ctx)
+		return ctx
+	})
+	kami.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if v, err := claims(ctx); v != "user 42" || err != nil {
+					t.Error("unexpected value in handler:", v, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if err := failing(ctx); err != errBad {
+			t.Error("errors should be cached too, got", err)
+		}
+	})
+
+	for i := 1; i <= 2; i++ {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		if calls != i || failCalls != i {
+			t.Error("compute should run once per request; calls:", calls, failCalls, "requests:", i)
+		}
+	}
+
+	// outside of kami
+	claims(context.Background())
+	claims(context.Background())
+	if calls != 4 {
+		t.Error("outside of kami, compute should run every time; calls:", calls)
+	}
+}
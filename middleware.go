@@ -2,16 +2,43 @@ package kami
 
 import (
 	"net/http"
+	"reflect"
+	"runtime"
+	"time"
 
+	"github.com/zenazn/goji/web/mutil"
 	"golang.org/x/net/context"
 )
 
 // Middleware is a function that takes the current request context and returns a new request context.
 // You can use middleware to build your context before your handler handles a request.
 // As a special case, middleware that returns nil will halt middleware and handler execution (LogHandler will still run).
+// Middleware that wants to halt while keeping its context can return Halt(ctx).
 type Middleware func(context.Context, http.ResponseWriter, *http.Request) context.Context
 
-var middleware = make(map[string][]Middleware)
+// haltedContext marks a context returned by Halt.
+type haltedContext struct {
+	context.Context
+}
+
+// Halt marks ctx as halted. Middleware can return Halt(ctx) after responding to the request itself,
+// for example to serve a maintenance page. Further middleware and the route handler will be skipped,
+// but LogHandler will still run and receive ctx.
+func Halt(ctx context.Context) context.Context {
+	return haltedContext{ctx}
+}
+
+// Afterware is a function that will run after middleware and the request handler.
+// Afterware takes the request context and returns a new context, but unlike middleware,
+// returning nil won't halt the execution of other afterware.
+type Afterware func(context.Context, mutil.WriterProxy, *http.Request) context.Context
+
+var (
+	middleware = make(map[string][]Middleware)
+	afterware  = make(map[string][]Afterware)
+	outermost  []Middleware
+	innermost  []Middleware
+)
 
 // Use registers middleware to run for the given path.
 // Middleware with be executed hierarchically, starting with the least specific path.
@@ -23,24 +50,174 @@ func Use(path string, fn Middleware) {
 	middleware[path] = chain
 }
 
+// UseWhen registers middleware to run for every request for which pred returns true, such as requests with a beta cookie.
+// It's the same as Use("/", When(pred, fn)), so it runs in order of registration with the other middleware for "/",
+// before middleware for more specific paths. To limit it to a path too, use When with Use.
+func UseWhen(pred func(*http.Request) bool, fn Middleware) {
+	Use("/", When(pred, fn))
+}
+
+// When returns middleware that runs fn only when pred returns true for the request, and does nothing otherwise.
+// pred is checked for every request, when the middleware's turn comes.
+func When(pred func(*http.Request) bool, fn Middleware) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if !pred(r) {
+			return ctx
+		}
+		return fn(ctx, w, r)
+	}
+}
+
+// UseOutermost registers middleware that runs for every request before any middleware registered with Use,
+// no matter how specific its path is. It's meant for things like RequestID and logging that must wrap everything else.
+// Outermost middleware runs in registration order. If it halts, no other middleware runs, but afterware still does.
+func UseOutermost(fn Middleware) {
+	outermost = append(outermost, fn)
+}
+
+// UseInnermost registers middleware that runs for every request just before the handler,
+// after middleware registered with Use and middleware given when registering the route.
+// Innermost middleware runs in registration order.
+// Afterware isn't affected by either: it runs in its usual order after the handler.
+func UseInnermost(fn Middleware) {
+	innermost = append(innermost, fn)
+}
+
+// HaltInfo describes the middleware that halted a request.
+type HaltInfo struct {
+	// Path is the path the middleware was registered under.
+	// For middleware given when registering a route, this is the route's path.
+	// It's blank for middleware registered with UseOutermost or UseInnermost.
+	Path string
+	// Index is the position of the middleware among those registered for Path, starting at 0.
+	Index int
+	// Name is the name of the middleware function, as reported by the runtime.
+	// Anonymous functions will have names like "main.init.func1".
+	Name string
+}
+
+// HaltedBy returns the middleware that halted the request, if any.
+// This is useful in LogHandler to tell why a request was blocked.
+func HaltedBy(ctx context.Context) (HaltInfo, bool) {
+	info, ok := ctx.Value(haltKey).(HaltInfo)
+	return info, ok
+}
+
+func newContextWithHalt(ctx context.Context, path string, index int, mw Middleware) context.Context {
+	info := HaltInfo{
+		Path:  path,
+		Index: index,
+	}
+	info.Name = funcName(mw)
+	return context.WithValue(ctx, haltKey, info)
+}
+
+// funcName returns the name of the function fn, or a blank string if it can't be found.
+func funcName(fn interface{}) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+// After registers afterware to run for the given path, after the handler.
+// Afterware runs even if middleware halted the request, and before LogHandler.
+// If the request panicked, afterware runs after PanicHandler and kami.Exception(ctx) will return the panic details.
+// Afterware will be executed hierarchically in reverse, starting with the most specific path.
+// Within a path, afterware will be executed in order of registration.
+// Adding afterware is not threadsafe.
+func After(path string, fn Afterware) {
+	chain := afterware[path]
+	chain = append(chain, fn)
+	afterware[path] = chain
+}
+
+// OnStatus returns afterware that only runs fn when the response status matches pred.
+// If nothing has been written yet, the status is considered to be 200 OK.
+// Note that headers written by fn will only be sent if the handler hasn't written its response yet.
+func OnStatus(pred func(status int) bool, fn Afterware) Afterware {
+	return func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+		status := w.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if !pred(status) {
+			return ctx
+		}
+		return fn(ctx, w, r)
+	}
+}
+
 // run runs the middleware chain for a particular request.
 // run returns false if it should stop early.
-func run(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+func run(ctx context.Context, req *request, r *http.Request) (context.Context, bool) {
 	for i, c := range r.URL.Path {
 		if c == '/' || i == len(r.URL.Path)-1 {
 			wares, ok := middleware[r.URL.Path[:i+1]]
 			if !ok {
 				continue
 			}
-			for _, mw := range wares {
-				// return nil middleware to stop
-				result := mw(ctx, w, r)
-				if result == nil {
-					return ctx, false
-				}
-				ctx = result
+			var cont bool
+			if ctx, cont = runChain(ctx, req, r, r.URL.Path[:i+1], wares); !cont {
+				return ctx, false
 			}
 		}
 	}
 	return ctx, true
 }
+
+// runChain runs middleware registered under path, returning false if it should stop early.
+func runChain(ctx context.Context, req *request, r *http.Request, path string, wares []Middleware) (context.Context, bool) {
+	for i, mw := range wares {
+		var start time.Time
+		if timelineEnabled {
+			start = time.Now()
+		}
+		// return nil middleware to stop
+		result := mw(ctx, req.writer, r)
+		if timelineEnabled {
+			req.addSpan(SpanMiddleware, path, mw, start)
+		}
+		if result == nil {
+			return newContextWithHalt(ctx, path, i, mw), false
+		}
+		if halted, ok := result.(haltedContext); ok {
+			return newContextWithHalt(halted.Context, path, i, mw), false
+		}
+		ctx = result
+		req.ctx = ctx
+	}
+	return ctx, true
+}
+
+// runAfter runs the afterware chain for a particular request.
+func runAfter(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+	for i := len(r.URL.Path) - 1; i >= 0; i-- {
+		if r.URL.Path[i] == '/' || i == len(r.URL.Path)-1 {
+			wares, ok := afterware[r.URL.Path[:i+1]]
+			if !ok {
+				continue
+			}
+			for _, aw := range wares {
+				var start time.Time
+				if timelineEnabled {
+					start = time.Now()
+				}
+				// ignore nil afterware
+				result := aw(ctx, w, r)
+				if timelineEnabled {
+					if req := requestFrom(ctx); req != nil {
+						req.addSpan(SpanAfterware, r.URL.Path[:i+1], aw, start)
+					}
+				}
+				if result != nil {
+					ctx = result
+					if req := requestFrom(ctx); req != nil {
+						req.ctx = ctx
+					}
+				}
+			}
+		}
+	}
+	return ctx
+}
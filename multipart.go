@@ -0,0 +1,68 @@
+package kami
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	"golang.org/x/net/context"
+)
+
+// MultipartWriter streams a multipart/mixed response. See Multipart.
+type MultipartWriter struct {
+	ctx context.Context
+	w   http.ResponseWriter
+	mw  *multipart.Writer
+}
+
+// Multipart starts a multipart/mixed response, for sending several parts (such as files) in one response
+// without buffering them all. It sets the Content-Type header, with a random boundary.
+// Add parts with AddPart, then call Close to finish the response.
+func Multipart(ctx context.Context, w http.ResponseWriter) *MultipartWriter {
+	mpw := &MultipartWriter{ctx: ctx, w: w, mw: multipart.NewWriter(w)}
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mpw.mw.Boundary())
+	return mpw
+}
+
+// AddPart writes a part with the given headers (such as Content-Type and Content-Disposition) and the contents of r,
+// and flushes it to the client.
+// It stops and returns the context's error if ctx is cancelled or the client disconnects.
+func (mpw *MultipartWriter) AddPart(header http.Header, r io.Reader) error {
+	if err := mpw.err(); err != nil {
+		return err
+	}
+	part, err := mpw.mw.CreatePart(textproto.MIMEHeader(header))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, &contextReader{ctx: mpw.ctx, Reader: r}); err != nil {
+		return err
+	}
+	mpw.flush()
+	return nil
+}
+
+// Close writes the closing boundary and flushes it.
+func (mpw *MultipartWriter) Close() error {
+	if err := mpw.mw.Close(); err != nil {
+		return err
+	}
+	mpw.flush()
+	return nil
+}
+
+func (mpw *MultipartWriter) err() error {
+	select {
+	case <-mpw.ctx.Done():
+		return mpw.ctx.Err()
+	default:
+		return nil
+	}
+}
+
+func (mpw *MultipartWriter) flush() {
+	if f, ok := mpw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,87 @@
+package kami_test
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestMultipart(t *testing.T) {
+	next := make(chan struct{}, 1)
+	kami.Reset()
+	kami.Get("/export", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		mpw := kami.Multipart(ctx, w)
+		for _, name := range []string{"a.csv", "b.csv"} {
+			<-next
+			header := http.Header{"Content-Type": {"text/csv"}, "Content-Disposition": {`attachment; filename="` + name + `"`}}
+			if err := mpw.AddPart(header, strings.NewReader("data for "+name)); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := mpw.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	kami.Get("/cancelled", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		mpw := kami.Multipart(ctx, w)
+		kami.Cancel(ctx)
+		if err := mpw.AddPart(nil, strings.NewReader("nope")); err != context.Canceled {
+			t.Error("expected context.Canceled, got", err)
+		}
+	})
+
+	// the response starts with the first part
+	next <- struct{}{}
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" || params["boundary"] == "" {
+		t.Fatal("unexpected Content-Type:", resp.Header.Get("Content-Type"), err)
+	}
+
+	// each part should arrive before the next one is written
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for i, name := range []string{"a.csv", "b.csv"} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.FileName() != name || part.Header.Get("Content-Type") != "text/csv" {
+			t.Error("unexpected part headers:", part.Header)
+		}
+		// the part doesn't end until the next boundary, so just read what's been sent
+		data := make([]byte, len("data for "+name))
+		if _, err := io.ReadFull(part, data); err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "data for "+name {
+			t.Error("unexpected part body:", string(data))
+		}
+		if i == 0 {
+			next <- struct{}{}
+		}
+	}
+	if _, err := mr.NextPart(); err == nil || err.Error() != "EOF" {
+		t.Error("expected the closing boundary, got", err)
+	}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/cancelled", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(w, req)
+}
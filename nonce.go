@@ -0,0 +1,32 @@
+package kami
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"golang.org/x/net/context"
+)
+
+// Nonce returns a random base64 nonce for the current request, such as for a Content-Security-Policy header
+// like script-src 'nonce-...' and the matching nonce attributes on inline script tags.
+// It's made with crypto/rand the first time it's called, and every later call for the same request returns the same one,
+// so the header and templates agree.
+// If ctx didn't come from kami, a new nonce is returned every time.
+func Nonce(ctx context.Context) string {
+	req := requestFrom(ctx)
+	if req == nil {
+		return newNonce()
+	}
+	req.nonceOnce.Do(func() {
+		req.nonce = newNonce()
+	})
+	return req.nonce
+}
+
+func newNonce() string {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf[:])
+}
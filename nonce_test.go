@@ -0,0 +1,49 @@
+package kami_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestNonce(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		w.Header().Set("Content-Security-Policy", "script-src 'nonce-"+kami.Nonce(ctx)+"'")
+		return ctx
+	})
+	kami.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<script nonce="` + kami.Nonce(ctx) + `"></script>`))
+	})
+
+	var nonces []string
+	for i := 0; i < 2; i++ {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+
+		var header, body string
+		csp := resp.Header().Get("Content-Security-Policy")
+		header = csp[len("script-src 'nonce-") : len(csp)-1]
+		body = resp.Body.String()
+		body = body[len(`<script nonce="`) : len(body)-len(`"></script>`)]
+		if header != body {
+			t.Error("header and body nonces should match:", header, "≠", body)
+		}
+		if data, err := base64.StdEncoding.DecodeString(header); err != nil || len(data) != 16 {
+			t.Error("nonce should be 16 random bytes in base64:", header, err)
+		}
+		nonces = append(nonces, header)
+	}
+	if nonces[0] == nonces[1] {
+		t.Error("each request should get its own nonce")
+	}
+}
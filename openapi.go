@@ -0,0 +1,136 @@
+package kami
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// RouteDoc documents a route for OpenAPI.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	// Params documents parameters. Path parameters from the route's pattern are included automatically,
+	// but can be listed here to describe them.
+	Params []ParamDoc
+}
+
+// ParamDoc documents a parameter for OpenAPI.
+type ParamDoc struct {
+	Name string
+	// In is where the parameter goes: "path", "query", "header", or "cookie".
+	In          string
+	Description string
+	Required    bool
+}
+
+// OpenAPIInfo is the info section of the document made by OpenAPI.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// APIInfo is used for the info section of the document made by OpenAPI.
+var APIInfo = OpenAPIInfo{Title: "API", Version: "1.0.0"}
+
+// docs are the RouteDocs given to Document, by method and path.
+var docs = make(map[string]RouteDoc)
+
+// Document attaches documentation to the route registered for method and path, for OpenAPI.
+// It can be called before or after the route is registered.
+func Document(method, path string, doc RouteDoc) {
+	docs[method+" "+path] = doc
+}
+
+type openAPIDoc struct {
+	OpenAPI string                                 `json:"openapi"`
+	Info    OpenAPIInfo                            `json:"info"`
+	Paths   map[string]map[string]openAPIOperation `json:"paths"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []openAPIParam             `json:"parameters,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParam struct {
+	Name        string            `json:"name"`
+	In          string            `json:"in"`
+	Description string            `json:"description,omitempty"`
+	Required    bool              `json:"required,omitempty"`
+	Schema      map[string]string `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string `json:"description"`
+}
+
+// OpenAPI returns a minimal OpenAPI 3 document in JSON (which YAML tools can read too), listing every registered route
+// with its path parameters and anything given to Document.
+// It doesn't know about request or response bodies, so every operation just has a default response.
+// Routes with methods OpenAPI doesn't support are left out.
+func OpenAPI() ([]byte, error) {
+	doc := openAPIDoc{
+		OpenAPI: "3.0.3",
+		Info:    APIInfo,
+		Paths:   make(map[string]map[string]openAPIOperation),
+	}
+	for _, rt := range registered {
+		method := strings.ToLower(rt.method)
+		switch method {
+		case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+		default:
+			continue
+		}
+
+		rd := docs[rt.method+" "+rt.path]
+		op := openAPIOperation{
+			Summary:     rd.Summary,
+			Description: rd.Description,
+			Responses:   map[string]openAPIResponse{"default": {Description: "response"}},
+		}
+		path, params := openAPIPath(rt.path)
+		for _, name := range params {
+			p := openAPIParam{Name: name, In: "path", Required: true, Schema: map[string]string{"type": "string"}}
+			for _, pd := range rd.Params {
+				if pd.Name == name && pd.In == "path" {
+					p.Description = pd.Description
+				}
+			}
+			op.Parameters = append(op.Parameters, p)
+		}
+		for _, pd := range rd.Params {
+			if pd.In == "path" {
+				continue
+			}
+			op.Parameters = append(op.Parameters, openAPIParam{
+				Name:        pd.Name,
+				In:          pd.In,
+				Description: pd.Description,
+				Required:    pd.Required,
+				Schema:      map[string]string{"type": "string"},
+			})
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]openAPIOperation)
+		}
+		doc.Paths[path][method] = op
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// openAPIPath converts a route pattern like /users/:id to /users/{id}, returning the parameter names.
+func openAPIPath(pattern string) (string, []string) {
+	segments := strings.Split(pattern, "/")
+	var params []string
+	for i, seg := range segments {
+		if len(seg) > 1 && (seg[0] == ':' || seg[0] == '*') {
+			params = append(params, seg[1:])
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
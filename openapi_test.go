@@ -0,0 +1,85 @@
+package kami_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/guregu/kami"
+)
+
+func TestOpenAPI(t *testing.T) {
+	kami.Reset()
+	kami.APIInfo = kami.OpenAPIInfo{Title: "Users", Version: "2.0"}
+	kami.Get("/users/:id", noop)
+	kami.Document("GET", "/users/:id", kami.RouteDoc{
+		Summary: "Get a user",
+		Params: []kami.ParamDoc{
+			{Name: "id", In: "path", Description: "user ID"},
+			{Name: "fields", In: "query", Description: "fields to include"},
+		},
+	})
+	kami.Post("/users", noop)
+	kami.Document("POST", "/users", kami.RouteDoc{Summary: "Create a user", Description: "Makes a new user."})
+	kami.Get("/files/*path", noop)
+	kami.Handle("PURGE", "/cache", noop)
+
+	data, err := kami.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var want map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"openapi": "3.0.3",
+		"info": {"title": "Users", "version": "2.0"},
+		"paths": {
+			"/users/{id}": {
+				"get": {
+					"summary": "Get a user",
+					"parameters": [
+						{"name": "id", "in": "path", "description": "user ID", "required": true, "schema": {"type": "string"}},
+						{"name": "fields", "in": "query", "description": "fields to include", "schema": {"type": "string"}}
+					],
+					"responses": {"default": {"description": "response"}}
+				}
+			},
+			"/users": {
+				"post": {
+					"summary": "Create a user",
+					"description": "Makes a new user.",
+					"responses": {"default": {"description": "response"}}
+				}
+			},
+			"/files/{path}": {
+				"get": {
+					"parameters": [
+						{"name": "path", "in": "path", "required": true, "schema": {"type": "string"}}
+					],
+					"responses": {"default": {"description": "response"}}
+				}
+			}
+		}
+	}`), &want)
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("unexpected document:\n%s", data)
+	}
+
+	// Reset clears docs
+	kami.Reset()
+	kami.Post("/users", noop)
+	data, err = kami.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc = nil
+	json.Unmarshal(data, &doc)
+	op := doc["paths"].(map[string]interface{})["/users"].(map[string]interface{})["post"].(map[string]interface{})
+	if _, ok := op["summary"]; ok {
+		t.Error("Reset should clear route docs:", op)
+	}
+}
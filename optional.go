@@ -0,0 +1,31 @@
+package kami
+
+import (
+	"strings"
+)
+
+// HandleOptional registers a handler for a path whose last segment is an optional parameter, marked with a question mark.
+// For example, HandleOptional("GET", "/files/:name?", handle) handles both /files and /files/:name,
+// and kami.Param(ctx, "name") is blank for /files.
+// Like Handle, it panics if the route can't be registered, or if anything but the last segment is optional.
+func HandleOptional(method, path string, handle HandleFn, mw ...Middleware) {
+	i := strings.LastIndex(path, "/")
+	last := path[i+1:]
+	if strings.Contains(path[:i+1], "?") || !strings.HasPrefix(last, ":") || !strings.HasSuffix(last, "?") || len(last) < 3 {
+		panic("kami: optional route " + path + " must end in a parameter like /:name?")
+	}
+
+	full := path[:len(path)-1]
+	short := path[:i]
+	if short == "" {
+		short = "/"
+	}
+	h := bless(handle, true, full, mw, nil, false)
+	register(method, short, h, nil)
+	register(method, full, h, nil)
+}
+
+// GetOptional registers a GET handler with an optional last parameter. See HandleOptional.
+func GetOptional(path string, handle HandleFn, mw ...Middleware) {
+	HandleOptional("GET", path, handle, mw...)
+}
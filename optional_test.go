@@ -0,0 +1,73 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestGetOptional(t *testing.T) {
+	kami.Reset()
+	kami.GetOptional("/files/:name?", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "name="+kami.Param(ctx, "name"))
+	})
+	kami.GetOptional("/pages/:page?", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "page="+kami.Param(ctx, "page"))
+	})
+
+	expect := map[string]string{
+		"/files":       "name=",
+		"/files/a.txt": "name=a.txt",
+		"/pages":       "page=",
+		"/pages/about": "page=about",
+	}
+	for path, want := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Error("should return HTTP StatusOK(200) for", path, resp.Code, "≠", http.StatusOK)
+		}
+		if body := resp.Body.String(); body != want {
+			t.Error("unexpected body for", path, body, "≠", want)
+		}
+	}
+
+	for _, path := range []string{"/users/:id?/posts", "/files/name?", "/files/:?", "/files/:name"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic for", path)
+				}
+			}()
+			kami.GetOptional(path, noop)
+		}()
+	}
+
+	// the root works too
+	kami.Reset()
+	kami.GetOptional("/:page?", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "page="+kami.Param(ctx, "page"))
+	})
+	for path, want := range map[string]string{"/": "page=", "/about": "page=about"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if body := resp.Body.String(); body != want {
+			t.Error("unexpected body for", path, body, "≠", want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package kami
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Parallel runs each function concurrently and waits for them to finish.
+// Each function gets a context derived from ctx, which is cancelled when the first error is returned
+// or when ctx itself is done, so functions should give up on ctx.Done().
+// It returns the first error, or nil if every function succeeded.
+func Parallel(ctx context.Context, funcs ...func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	wg.Add(len(funcs))
+	for _, fn := range funcs {
+		go func(fn func(context.Context) error) {
+			defer wg.Done()
+			if err := fn(ctx); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(fn)
+	}
+	wg.Wait()
+	return firstErr
+}
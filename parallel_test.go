@@ -0,0 +1,50 @@
+package kami_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestParallel(t *testing.T) {
+	var count int32
+	ok := func(ctx context.Context) error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	}
+	if err := kami.Parallel(context.Background(), ok, ok, ok); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if count != 3 {
+		t.Error("expected every function to run, got", count)
+	}
+
+	// the first error cancels the rest
+	errTest := errors.New("test error")
+	wait := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return errors.New("not cancelled")
+		}
+	}
+	fail := func(ctx context.Context) error {
+		return errTest
+	}
+	if err := kami.Parallel(context.Background(), wait, fail, wait); err != errTest {
+		t.Error("expected test error, got", err)
+	}
+
+	// cancelling the parent aborts everything
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := kami.Parallel(ctx, wait, wait); err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+}
@@ -1,20 +1,39 @@
 package kami
 
 import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
 	"github.com/julienschmidt/httprouter"
 	"golang.org/x/net/context"
 )
 
+// key is the type of kami's context keys.
+// It is unexported, so kami's keys can't collide with keys defined in other packages,
+// even ones with the same underlying value. Use the accessors (Param, Exception, etc.) to read them.
 type key int
 
 const (
 	paramsKey key = iota
 	panicKey
+	localeKey
+	haltKey
+	requestKey
+	versionKey
+	errorDetailKey
+	requestIDKey
+	originalPathKey
+	passKey
+	variantKey
 )
 
 // Param returns a request URL parameter, or a blank string if it doesn't exist.
 // For example, with the path /v2/papers/:page
 // use kami.Param(ctx, "page") to access the :page variable.
+// Param looks up the context and scans the parameters every time it's called,
+// so handlers reading lots of parameters might want to use ParamsFrom instead.
 func Param(ctx context.Context, name string) string {
 	params, ok := ctx.Value(paramsKey).(httprouter.Params)
 	if !ok {
@@ -23,10 +42,107 @@ func Param(ctx context.Context, name string) string {
 	return params.ByName(name)
 }
 
+// RawParam is like Param, but returns the parameter as it appeared in the URL, without decoding it.
+// For example, with the path /files/*path, a request for /files/a%2Fb%20c has a Param of "/a/b c"
+// and a RawParam of "/a%2Fb%20c".
+// Note that httprouter matches routes using the decoded path, so an encoded slash still separates segments.
+// It returns a blank string if the parameter doesn't exist.
+func RawParam(ctx context.Context, name string) string {
+	req := requestFrom(ctx)
+	if req == nil || req.url == nil || req.route == "" {
+		return ""
+	}
+	pattern := strings.Split(req.route, "/")
+	segments := strings.Split(req.url.EscapedPath(), "/")
+	for i, seg := range pattern {
+		if len(seg) < 2 || seg[1:] != name || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		if seg[0] == '*' {
+			if i > len(segments) {
+				return ""
+			}
+			return "/" + strings.Join(segments[i:], "/")
+		}
+		if i < len(segments) {
+			return segments[i]
+		}
+	}
+	return ""
+}
+
+// SubPath returns the value of the route's catch-all parameter, whatever it's named.
+// For example, with the path /files/*filepath, a request for /files/a/b.txt has a SubPath of "/a/b.txt".
+// This lets handlers mounted under a catch-all (such as with Static or ReverseProxy) find their part of the path.
+// It returns a blank string for routes without a catch-all,
+// and the full (decoded) path for requests that didn't match a route, such as those handled by NotFound or Fallback.
+func SubPath(ctx context.Context) string {
+	req := requestFrom(ctx)
+	if req == nil {
+		return ""
+	}
+	if !req.matched || req.route == "" {
+		if req.url == nil {
+			return ""
+		}
+		return req.url.Path
+	}
+	if i := strings.LastIndexByte(req.route, '/'); i >= 0 && strings.HasPrefix(req.route[i+1:], "*") {
+		return Param(ctx, req.route[i+2:])
+	}
+	return ""
+}
+
+// ParamsFrom returns all of the request's URL parameters, in the order they appear in the route.
+// It returns nil if there are none.
+func ParamsFrom(ctx context.Context) httprouter.Params {
+	params, _ := ctx.Value(paramsKey).(httprouter.Params)
+	return params
+}
+
+// ParamByIndex returns the value of the i-th URL parameter, starting at 0,
+// or a blank string if there aren't that many.
+// For example, with the path /users/:id/posts/:post, ParamByIndex(ctx, 1) gives the :post variable.
+func ParamByIndex(ctx context.Context, i int) string {
+	params := ParamsFrom(ctx)
+	if i < 0 || i >= len(params) {
+		return ""
+	}
+	return params[i].Value
+}
+
 // Exception gets the "v" in panic(v). The panic details.
-// Only PanicHandler will receive a context you can use this with.
+// PanicHandler, afterware, LogHandler, and finalizers registered with Defer can use this to tell if the request panicked.
 func Exception(ctx context.Context) interface{} {
-	return ctx.Value(panicKey)
+	if v := ctx.Value(panicKey); v != nil {
+		return v
+	}
+	// contexts from before the panic (such as ones captured by finalizers) can still find it
+	if req := requestFrom(ctx); req != nil {
+		return req.exception
+	}
+	return nil
+}
+
+// ExceptionString returns the panic details from Exception as a readable message,
+// or a blank string if there was no panic.
+// Errors give their message, and if an error wraps a runtime.Error (like a nil pointer dereference),
+// the runtime error's message is used. Anything else is formatted with %v.
+func ExceptionString(ctx context.Context) string {
+	switch v := Exception(ctx).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		var rerr runtime.Error
+		if errors.As(v, &rerr) {
+			return rerr.Error()
+		}
+		return v.Error()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
 }
 
 func newContextWithParams(ctx context.Context, params httprouter.Params) context.Context {
@@ -36,3 +152,13 @@ func newContextWithParams(ctx context.Context, params httprouter.Params) context
 func newContextWithException(ctx context.Context, exception interface{}) context.Context {
 	return context.WithValue(ctx, panicKey, exception)
 }
+
+func newContextWithRequest(ctx context.Context, req *request) context.Context {
+	return context.WithValue(ctx, requestKey, req)
+}
+
+// requestFrom returns kami's state for the current request, or nil outside of kami.
+func requestFrom(ctx context.Context) *request {
+	req, _ := ctx.Value(requestKey).(*request)
+	return req
+}
@@ -0,0 +1,178 @@
+package kami
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	basePath string
+	// rewriters are the hooks registered with Rewrite.
+	rewriters []func(*http.Request)
+)
+
+// SetBasePath makes kami serve routes under the given prefix, for apps behind a proxy that doesn't strip it.
+// For example, with a base path of "/myapp", a request for /myapp/users/1 will be routed to /users/:id.
+// Requests outside of the base path will get the NotFound handler.
+// Middleware is registered and matched without the base path.
+func SetBasePath(path string) {
+	basePath = strings.TrimRight(path, "/")
+}
+
+// URL builds a path from a route pattern, filling in parameters from name/value pairs.
+// The base path is prepended.
+// For example, URL("/users/:id", "id", "1") returns "/users/1".
+// Missing parameters are left blank.
+func URL(pattern string, params ...string) string {
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if len(seg) == 0 || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		value := ""
+		for j := 0; j+1 < len(params); j += 2 {
+			if params[j] == seg[1:] {
+				value = params[j+1]
+				break
+			}
+		}
+		if seg[0] == '*' {
+			// catch-all values can span segments
+			segments[i] = strings.TrimPrefix(value, "/")
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	return basePath + strings.Join(segments, "/")
+}
+
+// Rewrite registers fn to change requests before they're routed, for things like removing a locale prefix
+// or rewriting legacy paths. fn gets a copy of the request, so it can change r.URL.Path, headers, and so on.
+// Rewrites run in registration order, before the base path is removed.
+// Middleware and handlers see the rewritten request; use OriginalPath to get the path as it was requested.
+func Rewrite(fn func(*http.Request)) {
+	rewriters = append(rewriters, fn)
+}
+
+// OriginalPath returns the request's path from before any Rewrite hooks changed it.
+// If there are no rewrites, that's the same as r.URL.Path (including the base path).
+// It returns a blank string if ctx didn't come from kami.
+func OriginalPath(ctx context.Context) string {
+	req := requestFrom(ctx)
+	if req == nil {
+		return ""
+	}
+	if req.originalPath != "" {
+		return req.originalPath
+	}
+	if req.r != nil {
+		return req.r.URL.Path
+	}
+	return ""
+}
+
+// rewrite runs the Rewrite hooks on a copy of r.
+func rewrite(r *http.Request) *http.Request {
+	r = r.Clone(context.WithValue(r.Context(), originalPathKey, r.URL.Path))
+	for _, fn := range rewriters {
+		fn(r)
+	}
+	return r
+}
+
+// dispatch is the http.Handler returned by Handler.
+func dispatch(w http.ResponseWriter, r *http.Request) {
+	if len(rewriters) > 0 {
+		r = rewrite(r)
+	}
+	if basePath == "" {
+		routes.ServeHTTP(w, r)
+		return
+	}
+
+	rest, ok := trimBase(r.URL.Path)
+	if !ok {
+		notFound(w, r, nil)
+		return
+	}
+
+	// so OriginalPath includes the base path, like it does when there are rewrites
+	if _, ok := r.Context().Value(originalPathKey).(string); !ok {
+		r = r.WithContext(context.WithValue(r.Context(), originalPathKey, r.URL.Path))
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = rest
+	if raw, ok := trimBase(r.URL.RawPath); ok {
+		r2.URL.RawPath = raw
+	} else {
+		r2.URL.RawPath = ""
+	}
+
+	// the router might redirect (trailing slashes, etc.), so put the base path back in those
+	if _, _, ok := routes.Lookup(r2.Method, rest); !ok {
+		w = redirectWriter{w}
+	}
+	routes.ServeHTTP(w, r2)
+}
+
+// trimBase removes the base path from path, returning false if path is outside of it.
+func trimBase(path string) (string, bool) {
+	if !strings.HasPrefix(path, basePath) {
+		return "", false
+	}
+	rest := path[len(basePath):]
+	if rest == "" {
+		return "/", true
+	}
+	if rest[0] != '/' {
+		return "", false
+	}
+	return rest, true
+}
+
+// redirectWriter adds the base path to relative redirects.
+type redirectWriter struct {
+	http.ResponseWriter
+}
+
+func (w redirectWriter) WriteHeader(code int) {
+	loc := w.Header().Get("Location")
+	if code >= 300 && code < 400 && strings.HasPrefix(loc, "/") {
+		w.Header().Set("Location", basePath+loc)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+const (
+	// DefaultMaxPathLength is a reasonable path length limit for PathLimits.
+	DefaultMaxPathLength = 2048
+	// DefaultMaxPathSegments is a reasonable segment limit for PathLimits.
+	DefaultMaxPathSegments = 64
+)
+
+// PathLimits returns middleware that rejects requests with absurdly long or deep paths.
+// Paths longer than maxLen bytes (as sent, so still escaped) get 414 URI Too Long,
+// and paths with more than maxSegments segments get 400 Bad Request. A limit of zero means no limit.
+// See DefaultMaxPathLength and DefaultMaxPathSegments for sensible values.
+// Register it with UseOutermost so it runs before any other middleware.
+func PathLimits(maxLen int, maxSegments int) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		path := r.URL.EscapedPath()
+		if maxLen > 0 && len(path) > maxLen {
+			ClientError(ctx, w, http.StatusRequestURITooLong, "path is longer than "+strconv.Itoa(maxLen)+" bytes")
+			return nil
+		}
+		if maxSegments > 0 && strings.Count(path, "/") > maxSegments {
+			ClientError(ctx, w, http.StatusBadRequest, "path has more than "+strconv.Itoa(maxSegments)+" segments")
+			return nil
+		}
+		return ctx
+	}
+}
@@ -0,0 +1,186 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestBasePath(t *testing.T) {
+	kami.Reset()
+	kami.SetBasePath("/myapp/")
+	kami.Use("/users/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		return context.WithValue(ctx, "users", true)
+	})
+	kami.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "index")
+	})
+	kami.Get("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if ctx.Value("users") != true {
+			t.Error("middleware didn't run")
+		}
+		if got := kami.OriginalPath(ctx); got != "/myapp"+r.URL.Path {
+			t.Error("OriginalPath should include the base path:", got)
+		}
+		io.WriteString(w, "user "+kami.Param(ctx, "id"))
+	})
+	kami.Get("/posts/", noop)
+
+	tests := []struct {
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{"/myapp/users/1", http.StatusOK, "user 1", ""},
+		{"/myapp", http.StatusOK, "index", ""},
+		{"/myapp/", http.StatusOK, "index", ""},
+		{"/users/1", http.StatusNotFound, "", ""},
+		{"/myappusers/1", http.StatusNotFound, "", ""},
+		{"/myapp/missing", http.StatusNotFound, "", ""},
+		{"/myapp/posts", http.StatusMovedPermanently, "", "/myapp/posts/"},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Error("unexpected status for", test.path, resp.Code, "≠", test.code)
+		}
+		if test.body != "" && resp.Body.String() != test.body {
+			t.Error("unexpected body for", test.path, resp.Body.String(), "≠", test.body)
+		}
+		if loc := resp.Header().Get("Location"); loc != test.location {
+			t.Error("unexpected location for", test.path, loc, "≠", test.location)
+		}
+		if req.URL.Path != test.path {
+			t.Error("request was modified:", req.URL.Path, "≠", test.path)
+		}
+	}
+
+	if url := kami.URL("/users/:id", "id", "1"); url != "/myapp/users/1" {
+		t.Error("unexpected URL:", url)
+	}
+}
+
+func TestURL(t *testing.T) {
+	kami.Reset()
+	tests := []struct {
+		pattern string
+		params  []string
+		expect  string
+	}{
+		{"/", nil, "/"},
+		{"/users/:id", []string{"id", "42"}, "/users/42"},
+		{"/users/:id/posts/:post", []string{"post", "a b", "id", "7"}, "/users/7/posts/a%20b"},
+		{"/files/*path", []string{"path", "/css/app.css"}, "/files/css/app.css"},
+		{"/users/:id", nil, "/users/"},
+	}
+	for _, test := range tests {
+		if got := kami.URL(test.pattern, test.params...); got != test.expect {
+			t.Error("unexpected URL for", test.pattern, got, "≠", test.expect)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	kami.Reset()
+	kami.Rewrite(func(r *http.Request) {
+		for _, lang := range []string{"/en", "/ja"} {
+			if rest := strings.TrimPrefix(r.URL.Path, lang); rest != r.URL.Path && (rest == "" || rest[0] == '/') {
+				r.Header.Set("Accept-Language", lang[1:])
+				r.URL.Path = rest
+				r.URL.RawPath = ""
+				return
+			}
+		}
+	})
+	var logged string
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		logged = kami.OriginalPath(ctx) + " → " + r.URL.Path
+	}
+	kami.Get("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, kami.Param(ctx, "id")+" "+r.Header.Get("Accept-Language"))
+	})
+
+	expect := []struct {
+		path, body, logged string
+	}{
+		{"/en/users/1", "1 en", "/en/users/1 → /users/1"},
+		{"/ja/users/2", "2 ja", "/ja/users/2 → /users/2"},
+		{"/users/3", "3 ", "/users/3 → /users/3"},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+		}
+		if resp.Body.String() != e.body {
+			t.Error("unexpected body for", e.path, resp.Body.String(), "≠", e.body)
+		}
+		if logged != e.logged {
+			t.Error("unexpected log for", e.path, logged, "≠", e.logged)
+		}
+		if req.URL.Path != e.path || req.Header.Get("Accept-Language") != "" {
+			t.Error("the original request shouldn't be changed:", req.URL.Path, req.Header)
+		}
+	}
+}
+
+func TestPathLimits(t *testing.T) {
+	kami.Reset()
+	kami.UseOutermost(kami.PathLimits(10, 3))
+	kami.Get("/*path", noop)
+
+	expect := map[string]int{
+		"/abcdefghi":  http.StatusOK,                // 10 bytes
+		"/abcdefghij": http.StatusRequestURITooLong, // 11 bytes
+		"/a%20cdefg":  http.StatusOK,                // 10 bytes escaped
+		"/a%20cdefgh": http.StatusRequestURITooLong, // 11 bytes escaped
+		"/a/b/c":      http.StatusOK,                // 3 segments
+		"/a/b/c/":     http.StatusBadRequest,        // 4 segments
+		"/a/b/c/d":    http.StatusBadRequest,        // 4 segments
+	}
+	for path, want := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != want {
+			t.Error("unexpected status for", path, resp.Code, "≠", want)
+		}
+	}
+
+	// zero means no limit
+	kami.Reset()
+	kami.UseOutermost(kami.PathLimits(0, 0))
+	kami.Get("/*path", noop)
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/"+strings.Repeat("a/", 500), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+	}
+}
@@ -0,0 +1,53 @@
+package kami
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// ProblemDetails is an RFC 7807 problem details object.
+type ProblemDetails struct {
+	// Type is a URI identifying the problem type. It defaults to "about:blank".
+	Type string `json:"type"`
+	// Title is a short summary of the problem type. It defaults to the status text.
+	Title string `json:"title"`
+	// Status is the HTTP status code. Problem fills this in.
+	Status int `json:"status"`
+	// Detail is an explanation specific to this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is a URI identifying this occurrence of the problem.
+	Instance string `json:"instance,omitempty"`
+}
+
+// Problem writes an RFC 7807 application/problem+json response with the given status.
+func Problem(w http.ResponseWriter, status int, detail ProblemDetails) {
+	detail.Status = status
+	if detail.Type == "" {
+		detail.Type = "about:blank"
+	}
+	if detail.Title == "" {
+		detail.Title = http.StatusText(status)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	JSON(w, status, detail)
+}
+
+// ProblemNotFound is a NotFound handler that responds with problem details.
+// Use it like kami.NotFound(kami.ProblemNotFound).
+func ProblemNotFound(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	Problem(w, http.StatusNotFound, ProblemDetails{Instance: r.URL.Path})
+}
+
+// ProblemMethodNotAllowed is a MethodNotAllowed handler that responds with problem details.
+// Use it like kami.MethodNotAllowed(kami.ProblemMethodNotAllowed).
+func ProblemMethodNotAllowed(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	Problem(w, http.StatusMethodNotAllowed, ProblemDetails{Instance: r.URL.Path})
+}
+
+// ProblemPanicHandler is a PanicHandler that responds with problem details.
+// The panic details aren't included, so they won't leak to clients.
+func ProblemPanicHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	Problem(w, http.StatusInternalServerError, ProblemDetails{Instance: r.URL.Path})
+}
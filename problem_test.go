@@ -0,0 +1,68 @@
+package kami_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestProblem(t *testing.T) {
+	kami.Reset()
+	kami.NotFound(kami.ProblemNotFound)
+	kami.MethodNotAllowed(kami.ProblemMethodNotAllowed)
+	kami.PanicHandler = kami.ProblemPanicHandler
+	kami.Get("/thing", noop)
+	kami.Get("/panic", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("secret details")
+	})
+	kami.Get("/custom", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Problem(w, http.StatusPaymentRequired, kami.ProblemDetails{
+			Type:   "https://example.com/probs/out-of-credit",
+			Title:  "You do not have enough credit.",
+			Detail: "Your current balance is 30, but that costs 50.",
+		})
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		expect kami.ProblemDetails
+	}{
+		{"GET", "/missing", kami.ProblemDetails{Type: "about:blank", Title: "Not Found", Status: 404, Instance: "/missing"}},
+		{"POST", "/thing", kami.ProblemDetails{Type: "about:blank", Title: "Method Not Allowed", Status: 405, Instance: "/thing"}},
+		{"GET", "/panic", kami.ProblemDetails{Type: "about:blank", Title: "Internal Server Error", Status: 500, Instance: "/panic"}},
+		{"GET", "/custom", kami.ProblemDetails{
+			Type:   "https://example.com/probs/out-of-credit",
+			Title:  "You do not have enough credit.",
+			Status: 402,
+			Detail: "Your current balance is 30, but that costs 50.",
+		}},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != test.expect.Status {
+			t.Error("unexpected status for", test.path, resp.Code, "≠", test.expect.Status)
+		}
+		if ct := resp.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Error("unexpected content type:", ct)
+		}
+		var got kami.ProblemDetails
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != test.expect {
+			t.Errorf("unexpected problem for %s: %+v ≠ %+v", test.path, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package kami
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// ProxyOptions configures ReverseProxy.
+type ProxyOptions struct {
+	// StripPrefix removes the prefix from the path before forwarding,
+	// so a request for /api/users with the prefix /api is sent upstream as /users.
+	StripPrefix bool
+	// Rewrite, if set, can modify the outgoing request, for example to set or remove headers.
+	// It runs after the URL has been rewritten for the target.
+	Rewrite func(*http.Request)
+	// ModifyResponse, if set, can modify the upstream response before it is sent.
+	ModifyResponse func(*http.Response) error
+	// ErrorHandler is called if the upstream can't be reached or ModifyResponse fails.
+	// If nil, kami logs the error and responds with a 502 Bad Gateway error from ErrorRenderer.
+	ErrorHandler func(http.ResponseWriter, *http.Request, error)
+}
+
+// ReverseProxy registers a catch-all route under prefix that forwards every request to target.
+// Middleware runs as usual before the request is forwarded, and the upstream request uses the request's context,
+// so deadlines and cancellation set by middleware (or a disconnecting client) also stop the upstream request.
+// The returned error is the same as Any's.
+func ReverseProxy(prefix string, target *url.URL, opts ProxyOptions) error {
+	prefix = strings.TrimRight(prefix, "/")
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		if opts.Rewrite != nil {
+			opts.Rewrite(r)
+		}
+	}
+	proxy.ModifyResponse = opts.ModifyResponse
+	proxy.ErrorHandler = opts.ErrorHandler
+	if proxy.ErrorHandler == nil {
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("kami: proxy error for %s %s: %v", r.Method, r.URL.Path, err)
+			// the request has kami's context, from handle
+			renderError(r.Context(), w, r, http.StatusBadGateway)
+		}
+	}
+
+	handle := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		r2 := r.WithContext(ctx)
+		if opts.StripPrefix {
+			u := *r.URL
+			u.Path = "/" + strings.TrimPrefix(Param(ctx, "path"), "/")
+			u.RawPath = ""
+			// keep escapes like %2F in the rest of the path, so it isn't split into more segments upstream
+			if raw := r.URL.EscapedPath(); strings.HasPrefix(raw, prefix+"/") {
+				u.RawPath = raw[len(prefix):]
+			}
+			r2.URL = &u
+		}
+		proxy.ServeHTTP(w, r2)
+	}
+
+	return Any(prefix+"/*path", handle)
+}
@@ -0,0 +1,110 @@
+package kami_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestReverseProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.EscapedPath())
+		w.Header().Set("X-Upstream-Auth", r.Header.Get("X-Auth"))
+		io.WriteString(w, r.Method)
+	}))
+	defer upstream.Close()
+	target, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is listening here
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL, _ := url.Parse(dead.URL)
+	dead.Close()
+
+	kami.Reset()
+	var ranMiddleware bool
+	kami.Use("/api/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		ranMiddleware = true
+		return ctx
+	})
+	if err := kami.ReverseProxy("/api", target, kami.ProxyOptions{
+		StripPrefix: true,
+		Rewrite: func(r *http.Request) {
+			r.Header.Set("X-Auth", "gateway")
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kami.ReverseProxy("/raw/", target, kami.ProxyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kami.ReverseProxy("/dead", deadURL, kami.ProxyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []struct {
+		method, path string
+		status       int
+		upstreamPath string
+		auth         string
+	}{
+		{"GET", "/api/users/1", http.StatusOK, "/users/1", "gateway"},
+		{"POST", "/api/users", http.StatusOK, "/users", "gateway"},
+		{"GET", "/api/files/a%2Fb", http.StatusOK, "/files/a%2Fb", "gateway"},
+		{"GET", "/raw/thing", http.StatusOK, "/raw/thing", ""},
+		{"GET", "/dead/thing", http.StatusBadGateway, "", ""},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(e.method, e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.method, e.path, resp.Code, "≠", e.status)
+			continue
+		}
+		if e.status != http.StatusOK {
+			continue
+		}
+		if got := resp.Header().Get("X-Upstream-Path"); got != e.upstreamPath {
+			t.Error("unexpected upstream path for", e.path, got, "≠", e.upstreamPath)
+		}
+		if got := resp.Header().Get("X-Upstream-Auth"); got != e.auth {
+			t.Error("unexpected upstream header for", e.path, got, "≠", e.auth)
+		}
+		if body, _ := ioutil.ReadAll(resp.Body); string(body) != e.method {
+			t.Error("unexpected body for", e.path, string(body))
+		}
+	}
+	if !ranMiddleware {
+		t.Error("middleware should run before proxying")
+	}
+
+	// errors go through ErrorRenderer
+	kami.ErrorRenderer = func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int) {
+		w.WriteHeader(status)
+		io.WriteString(w, "rendered "+strconv.Itoa(status))
+	}
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/dead/thing", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusBadGateway || resp.Body.String() != "rendered 502" {
+		t.Error("proxy errors should use ErrorRenderer", resp.Code, resp.Body.String())
+	}
+}
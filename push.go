@@ -0,0 +1,39 @@
+package kami
+
+import (
+	"errors"
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// ErrPushNotSupported is returned by Push when the response can't do HTTP/2 server push, such as over HTTP/1.1.
+var ErrPushNotSupported = errors.New("kami: HTTP/2 server push isn't supported for this request")
+
+// Push starts an HTTP/2 server push of target, such as a stylesheet the page will need, like http.Pusher.
+// It finds the http.Pusher even if middleware has replaced the writer with SetWriter.
+// Pushes must be started before the response is written, since they're announced before it.
+// It returns ErrPushNotSupported if the connection can't push, http.ErrNotSupported if the client has disabled push,
+// or the context's error if ctx is done, so callers can just carry on without pushing.
+func Push(ctx context.Context, w http.ResponseWriter, target string, opts *http.PushOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for w != nil {
+		if p, ok := w.(http.Pusher); ok {
+			return p.Push(target, opts)
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	// writers from SetWriter usually hide it
+	if req := requestFrom(ctx); req != nil {
+		if p, ok := req.root.(http.Pusher); ok {
+			return p.Push(target, opts)
+		}
+	}
+	return ErrPushNotSupported
+}
@@ -0,0 +1,100 @@
+package kami_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/guregu/kami"
+)
+
+func TestPush(t *testing.T) {
+	pushErrs := make(chan error, 1)
+	kami.Reset()
+	kami.Use("/", kami.Compress())
+	kami.Get("/page", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		pushErrs <- kami.Push(ctx, w, "/style.css", nil)
+		w.Write([]byte("<link rel=stylesheet href=/style.css>"))
+	})
+	kami.Get("/style.css", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body{}"))
+	})
+
+	// HTTP/1.1: no pusher
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if err := <-pushErrs; err != kami.ErrPushNotSupported {
+		t.Error("expected ErrPushNotSupported, got", err)
+	}
+	if resp.Code != http.StatusOK {
+		t.Error("the response should carry on without pushing:", resp.Code)
+	}
+
+	// HTTP/2, with a client that accepts pushes
+	srv := httptest.NewUnstartedServer(kami.Handler())
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		t.Fatal(err)
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var hbuf bytes.Buffer
+	enc := hpack.NewEncoder(&hbuf)
+	for _, hf := range [][2]string{{":method", "GET"}, {":scheme", "https"}, {":authority", srv.Listener.Addr().String()}, {":path", "/page"}} {
+		enc.WriteField(hpack.HeaderField{Name: hf[0], Value: hf[1]})
+	}
+	if err := framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: hbuf.Bytes(), EndStream: true, EndHeaders: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var promised string
+	dec := hpack.NewDecoder(4096, func(hf hpack.HeaderField) {
+		if hf.Name == ":path" {
+			promised = hf.Value
+		}
+	})
+	for promised == "" {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.PushPromiseFrame:
+			if _, err := dec.Write(f.HeaderBlockFragment()); err != nil {
+				t.Fatal(err)
+			}
+		case *http2.GoAwayFrame:
+			t.Fatal("server sent GOAWAY:", f.ErrCode)
+		}
+	}
+	if promised != "/style.css" {
+		t.Error("unexpected push:", promised)
+	}
+	if err := <-pushErrs; err != nil {
+		t.Error("push should succeed over HTTP/2, got", err)
+	}
+}
@@ -0,0 +1,79 @@
+package kami
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// QueryValues returns every value of the named query parameter, in order.
+// For example, ?tag=a&tag=b gives []string{"a", "b"}.
+// It returns nil if the parameter isn't there.
+func QueryValues(r *http.Request, name string) []string {
+	return r.URL.Query()[name]
+}
+
+// QueryInt returns the named query parameter as an int, or def if it's missing or blank.
+// If the parameter can't be parsed, it returns def and a FieldError, like BindQuery would.
+// Repeated parameters use the first value.
+func QueryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, FieldError{Field: name, Source: "query", Err: fmt.Errorf("invalid integer %q", value)}
+	}
+	return n, nil
+}
+
+// QueryBool returns the named query parameter as a bool, or def if it's missing or blank.
+// Values are parsed with strconv.ParseBool, so "1", "t", "true" and so on are accepted.
+// If the parameter can't be parsed, it returns def and a FieldError, like BindQuery would.
+// Repeated parameters use the first value.
+func QueryBool(r *http.Request, name string, def bool) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return def, FieldError{Field: name, Source: "query", Err: fmt.Errorf("invalid boolean %q", value)}
+	}
+	return b, nil
+}
+
+// RequireQuery returns middleware that rejects requests missing any of the given query parameters with 400 Bad Request,
+// like RequireHeaders for the query string.
+// Parameters that are present but empty, like ?from=, count as missing. Use RequireQueryAllowEmpty to accept them.
+// The response is written by ClientError, with a message listing the missing parameters.
+func RequireQuery(names ...string) Middleware {
+	return requireQuery(names, false)
+}
+
+// RequireQueryAllowEmpty is like RequireQuery, but parameters only need to be present, so ?flag and ?from= are OK.
+func RequireQueryAllowEmpty(names ...string) Middleware {
+	return requireQuery(names, true)
+}
+
+func requireQuery(names []string, allowEmpty bool) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		query := r.URL.Query()
+		var missing []string
+		for _, name := range names {
+			values, ok := query[name]
+			if !ok || (!allowEmpty && values[0] == "") {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) == 0 {
+			return ctx
+		}
+		ClientError(ctx, w, http.StatusBadRequest, "missing query parameters: "+strings.Join(missing, ", "))
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/guregu/kami"
+)
+
+func TestQueryValues(t *testing.T) {
+	req, err := http.NewRequest("GET", "/?tag=a&tag=b&tag=c&empty=", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := kami.QueryValues(req, "tag"); !reflect.DeepEqual(tags, []string{"a", "b", "c"}) {
+		t.Error("unexpected tags:", tags)
+	}
+	if empty := kami.QueryValues(req, "empty"); !reflect.DeepEqual(empty, []string{""}) {
+		t.Error("unexpected value for a blank param:", empty)
+	}
+	if missing := kami.QueryValues(req, "missing"); missing != nil {
+		t.Error("missing param should give nil:", missing)
+	}
+}
+
+func TestQueryInt(t *testing.T) {
+	req, err := http.NewRequest("GET", "/?page=3&limit=&bad=x&n=1&n=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		name string
+		want int
+		ok   bool
+	}{
+		{"page", 3, true},
+		{"limit", 10, true},
+		{"missing", 10, true},
+		{"bad", 10, false},
+		{"n", 1, true},
+	}
+	for _, e := range expect {
+		n, err := kami.QueryInt(req, e.name, 10)
+		if n != e.want {
+			t.Error("unexpected value for", e.name, n, "≠", e.want)
+		}
+		if (err == nil) != e.ok {
+			t.Error("unexpected error for", e.name, err)
+		}
+	}
+
+	_, err = kami.QueryInt(req, "bad", 0)
+	if fe, ok := err.(kami.FieldError); !ok || fe.Field != "bad" || fe.Source != "query" {
+		t.Error("expected a FieldError, got", err)
+	}
+}
+
+func TestQueryBool(t *testing.T) {
+	req, err := http.NewRequest("GET", "/?debug=1&verbose=false&bad=maybe", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		name string
+		want bool
+		ok   bool
+	}{
+		{"debug", true, true},
+		{"verbose", false, true},
+		{"missing", true, true},
+		{"bad", true, false},
+	}
+	for _, e := range expect {
+		b, err := kami.QueryBool(req, e.name, true)
+		if b != e.want {
+			t.Error("unexpected value for", e.name, b, "≠", e.want)
+		}
+		if (err == nil) != e.ok {
+			t.Error("unexpected error for", e.name, err)
+		}
+	}
+}
+
+func TestRequireQuery(t *testing.T) {
+	kami.Reset()
+	kami.Get("/report", noop, kami.RequireQuery("from", "to"))
+	kami.Get("/lenient", noop, kami.RequireQueryAllowEmpty("from", "to"))
+
+	expect := []struct {
+		url     string
+		status  int
+		missing string
+	}{
+		{"/report?from=1&to=2", http.StatusOK, ""},
+		{"/report?from=1", http.StatusBadRequest, "to"},
+		{"/report?from=&to=2", http.StatusBadRequest, "from"},
+		{"/report", http.StatusBadRequest, "from, to"},
+		{"/lenient?from=&to", http.StatusOK, ""},
+		{"/lenient?to=2", http.StatusBadRequest, "from"},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", e.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.url, resp.Code, "≠", e.status)
+		}
+		if e.missing != "" && !strings.Contains(resp.Body.String(), "missing query parameters: "+e.missing) {
+			t.Error("error should list the missing parameters:", resp.Body.String())
+		}
+	}
+}
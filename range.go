@@ -0,0 +1,42 @@
+package kami
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ServeContentRange serves content like http.ServeContent, with support for Range and If-Range requests
+// for seeking in large files and media.
+// Satisfiable ranges get 206 Partial Content with a Content-Range header, and unsatisfiable ones get 416.
+// If-Range is checked against modtime and any ETag header already set on w.
+// Set Content-Type beforehand, otherwise it's sniffed from the content.
+// Streaming stops if ctx is cancelled or the client disconnects,
+// and since it writes through kami's response writer, LogHandler sees the bytes that were actually sent.
+func ServeContentRange(ctx context.Context, w http.ResponseWriter, r *http.Request, content io.ReadSeeker, modtime time.Time) {
+	cr := &contextReader{ctx: ctx, Reader: content}
+	http.ServeContent(w, r, "", modtime, contextReadSeeker{cr, content})
+}
+
+// contextReader stops reading once its context is done.
+type contextReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	select {
+	case <-cr.ctx.Done():
+		return 0, cr.ctx.Err()
+	default:
+	}
+	return cr.Reader.Read(p)
+}
+
+// contextReadSeeker is a contextReader that can seek.
+type contextReadSeeker struct {
+	*contextReader
+	io.Seeker
+}
@@ -0,0 +1,73 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestServeContentRange(t *testing.T) {
+	const content = "0123456789abcdefghij"
+	modtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	kami.Reset()
+	var logged int
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		logged = w.BytesWritten()
+	}
+	kami.Get("/video", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		kami.ServeContentRange(ctx, w, r, strings.NewReader(content), modtime)
+	})
+	kami.Get("/cancelled", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Cancel(ctx)
+		kami.ServeContentRange(ctx, w, r, strings.NewReader(content), modtime)
+	})
+
+	tests := []struct {
+		path   string
+		header map[string]string
+		status int
+		body   string
+		ranges string
+	}{
+		{"/video", nil, http.StatusOK, content, ""},
+		{"/video", map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, "2345", "bytes 2-5/20"},
+		{"/video", map[string]string{"Range": "bytes=100-200"}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */20"},
+		{"/video", map[string]string{"Range": "bytes=10-", "If-Range": modtime.Format(http.TimeFormat)}, http.StatusPartialContent, "abcdefghij", "bytes 10-19/20"},
+		{"/video", map[string]string{"Range": "bytes=10-", "If-Range": modtime.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK, content, ""},
+		{"/cancelled", nil, http.StatusOK, "", ""},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range test.header {
+			req.Header.Set(k, v)
+		}
+		logged = -1
+		kami.Handler().ServeHTTP(resp, req)
+
+		if resp.Code != test.status {
+			t.Error("unexpected status for", test.header, resp.Code, "≠", test.status)
+		}
+		if test.status != http.StatusRequestedRangeNotSatisfiable && resp.Body.String() != test.body {
+			t.Errorf("unexpected body for %v: %q ≠ %q", test.header, resp.Body.String(), test.body)
+		}
+		if got := resp.Header().Get("Content-Range"); got != test.ranges {
+			t.Error("unexpected Content-Range for", test.header, got, "≠", test.ranges)
+		}
+		if logged != resp.Body.Len() {
+			t.Error("LogHandler should see the bytes sent for", test.header, logged, "≠", resp.Body.Len())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package kami
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RateLimitOption configures RateLimit.
+type RateLimitOption func(*rateLimiter)
+
+// RateLimitBypass makes RateLimit let requests through without using up the limit when fn returns true,
+// for example for trusted internal callers. fn sees the context from the middleware before RateLimit,
+// so authentication middleware that marks trusted requests must be registered before it.
+func RateLimitBypass(fn func(ctx context.Context) bool) RateLimitOption {
+	return func(rl *rateLimiter) {
+		rl.bypass = fn
+	}
+}
+
+// rateLimiter is a token bucket.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	bypass func(context.Context) bool
+}
+
+// RateLimit returns middleware that allows n requests per interval, using a token bucket shared by every request it handles.
+// Up to n requests can come in at once, after which the limit refills steadily over the interval.
+// Requests over the limit are rejected with 429 Too Many Requests and a Retry-After header.
+// Register it under "/" for a global limit, or under a specific path for a per-route limit.
+func RateLimit(n int, interval time.Duration, opts ...RateLimitOption) Middleware {
+	rl := &rateLimiter{
+		rate:   float64(n) / interval.Seconds(),
+		burst:  float64(n),
+		tokens: float64(n),
+		last:   time.Now(),
+	}
+	for _, opt := range opts {
+		opt(rl)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if rl.bypass != nil && rl.bypass(ctx) {
+			return ctx
+		}
+		if wait, ok := rl.take(); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			ClientError(ctx, w, http.StatusTooManyRequests, "")
+			return nil
+		}
+		return ctx
+	}
+}
+
+// take uses up a token if there is one, or returns how long until there will be.
+func (rl *rateLimiter) take() (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.tokens = math.Min(rl.burst, rl.tokens+now.Sub(rl.last).Seconds()*rl.rate)
+	rl.last = now
+	if rl.tokens >= 1 {
+		rl.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - rl.tokens) / rl.rate * float64(time.Second)), false
+}
@@ -0,0 +1,64 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+type trustedKey struct{}
+
+func TestRateLimit(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if r.Header.Get("X-Internal-Token") == "secret" {
+			return context.WithValue(ctx, trustedKey{}, true)
+		}
+		return ctx
+	})
+	kami.Use("/", kami.RateLimit(2, time.Hour, kami.RateLimitBypass(func(ctx context.Context) bool {
+		trusted, _ := ctx.Value(trustedKey{}).(bool)
+		return trusted
+	})))
+	kami.Get("/", noop)
+
+	do := func(trusted bool) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trusted {
+			req.Header.Set("X-Internal-Token", "secret")
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	// trusted requests don't use up the limit
+	for i := 0; i < 5; i++ {
+		if resp := do(true); resp.Code != http.StatusOK {
+			t.Error("trusted request should bypass the limit", resp.Code, "≠", http.StatusOK)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if resp := do(false); resp.Code != http.StatusOK {
+			t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+		}
+	}
+	resp := do(false)
+	if resp.Code != http.StatusTooManyRequests {
+		t.Error("should return HTTP StatusTooManyRequests(429)", resp.Code, "≠", http.StatusTooManyRequests)
+	}
+	if resp.Header().Get("Retry-After") == "" {
+		t.Error("should send Retry-After")
+	}
+	if resp := do(true); resp.Code != http.StatusOK {
+		t.Error("trusted request should bypass the limit", resp.Code, "≠", http.StatusOK)
+	}
+}
@@ -0,0 +1,141 @@
+package kami
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// ErrorRenderer writes the error responses kami makes itself:
+// the default 404 Not Found and 405 Method Not Allowed handlers,
+// the 500 Internal Server Error for panics when there's no PanicHandler,
+// and client errors from kami's middleware (see ClientError).
+// It defaults to RenderError.
+var ErrorRenderer func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int) = RenderError
+
+// RenderError writes an error response for status, in the format the client prefers according to its Accept header:
+// an HTML page, RFC 7807 problem details JSON (see Problem), or plain text.
+// Plain text is used when the client doesn't say, or accepts anything equally.
+// The response includes ErrorDetail(ctx), if there is one.
+func RenderError(ctx context.Context, w http.ResponseWriter, r *http.Request, status int) {
+	detail := ErrorDetail(ctx)
+	switch negotiate(r, "text/plain", "text/html", "application/json", "application/problem+json") {
+	case "text/html":
+		text := strconv.Itoa(status) + " " + html.EscapeString(http.StatusText(status))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "<!DOCTYPE html>\n<title>%s</title>\n<h1>%s</h1>\n", text, text)
+		if detail != "" {
+			fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(detail))
+		}
+	case "application/json", "application/problem+json":
+		Problem(w, status, ProblemDetails{Detail: detail, Instance: r.URL.Path})
+	default:
+		msg := http.StatusText(status)
+		if detail != "" {
+			msg += ": " + detail
+		}
+		http.Error(w, msg, status)
+	}
+}
+
+// ErrorDetail returns the explanation of an error given to ErrorRenderer by kami's middleware,
+// such as which headers were missing for RequireHeaders, or a blank string.
+func ErrorDetail(ctx context.Context) string {
+	detail, _ := ctx.Value(errorDetailKey).(string)
+	return detail
+}
+
+func newContextWithErrorDetail(ctx context.Context, detail string) context.Context {
+	return context.WithValue(ctx, errorDetailKey, detail)
+}
+
+// ClientError responds to the current request with a client error (4xx) using ErrorRenderer,
+// with msg as the ErrorDetail. kami's own middleware uses it for errors like 400 Bad Request and 415 Unsupported Media Type,
+// so changing ErrorRenderer changes all of them.
+// If ctx didn't come from kami, it falls back to http.Error.
+func ClientError(ctx context.Context, w http.ResponseWriter, status int, msg string) {
+	req := requestFrom(ctx)
+	if req == nil || req.r == nil {
+		text := http.StatusText(status)
+		if msg != "" {
+			text += ": " + msg
+		}
+		http.Error(w, text, status)
+		return
+	}
+	if msg != "" {
+		ctx = newContextWithErrorDetail(ctx, msg)
+	}
+	renderError(ctx, w, req.r, status)
+}
+
+// renderError calls ErrorRenderer, or RenderError if it's nil.
+func renderError(ctx context.Context, w http.ResponseWriter, r *http.Request, status int) {
+	if ErrorRenderer == nil {
+		RenderError(ctx, w, r, status)
+		return
+	}
+	ErrorRenderer(ctx, w, r, status)
+}
+
+// negotiate returns the offer that best matches the request's Accept header,
+// or a blank string if none are acceptable.
+// More specific media ranges win over wildcards, and earlier offers win ties.
+// With no Accept header, the first offer is returned.
+func negotiate(r *http.Request, offers ...string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		for _, offer := range offers {
+			specificity := matchMedia(mediaRange, offer)
+			if specificity < 0 {
+				continue
+			}
+			if q > bestQ || (q == bestQ && specificity > bestSpecificity) {
+				best, bestQ, bestSpecificity = offer, q, specificity
+			}
+			// only the first matching offer counts for wildcards
+			break
+		}
+	}
+	return best
+}
+
+// matchMedia returns how specifically mediaRange matches typ: 2 for an exact match, 1 for type/*, 0 for */*,
+// or -1 if it doesn't match.
+func matchMedia(mediaRange, typ string) int {
+	switch {
+	case mediaRange == typ:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(typ, mediaRange[:len(mediaRange)-1]):
+		return 1
+	}
+	return -1
+}
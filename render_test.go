@@ -0,0 +1,121 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestRenderError(t *testing.T) {
+	kami.Reset()
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {}
+	kami.Get("/thing", noop)
+	kami.Get("/panic", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	expect := []struct {
+		method, path, accept string
+		status               int
+		contentType          string
+	}{
+		{"GET", "/missing", "", http.StatusNotFound, "text/plain; charset=utf-8"},
+		{"GET", "/missing", "*/*", http.StatusNotFound, "text/plain; charset=utf-8"},
+		{"GET", "/missing", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", http.StatusNotFound, "text/html; charset=utf-8"},
+		{"GET", "/missing", "application/json", http.StatusNotFound, "application/problem+json"},
+		{"POST", "/thing", "application/json, */*", http.StatusMethodNotAllowed, "application/problem+json"},
+		{"POST", "/thing", "text/html", http.StatusMethodNotAllowed, "text/html; charset=utf-8"},
+		{"GET", "/panic", "application/json", http.StatusInternalServerError, "application/problem+json"},
+		{"GET", "/panic", "text/html;q=0, text/*", http.StatusInternalServerError, "text/plain; charset=utf-8"},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(e.method, e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", e.accept)
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.method, e.path, e.accept, resp.Code, "≠", e.status)
+		}
+		if ct := resp.Header().Get("Content-Type"); ct != e.contentType {
+			t.Error("unexpected Content-Type for", e.method, e.path, e.accept, ct, "≠", e.contentType)
+		}
+	}
+
+	// custom renderer
+	kami.ErrorRenderer = func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int) {
+		w.WriteHeader(status)
+		w.Write([]byte("custom " + http.StatusText(status)))
+	}
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/thing", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if !strings.HasPrefix(resp.Body.String(), "custom Method Not Allowed") {
+		t.Error("unexpected body:", resp.Body.String())
+	}
+}
+
+func TestClientError(t *testing.T) {
+	kami.Reset()
+	kami.ErrorRenderer = func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int) {
+		w.WriteHeader(status)
+		w.Write([]byte("custom " + http.StatusText(status) + ": " + kami.ErrorDetail(ctx)))
+	}
+	kami.Post("/typed", noop, kami.RequireContentType("application/json"))
+	kami.Post("/signed", noop, kami.RequireHeaders("X-Signature"))
+	kami.Get("/versioned", noop, kami.APIVersion("X-Version", "v1"))
+	kami.Get("/limited", noop, kami.RateLimit(1, time.Hour))
+	// use up the limit
+	limited, err := http.NewRequest("GET", "/limited", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(httptest.NewRecorder(), limited)
+
+	expect := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"POST", "/typed", http.StatusUnsupportedMediaType, "custom Unsupported Media Type: Content-Type must be application/json"},
+		{"POST", "/signed", http.StatusBadRequest, "custom Bad Request: missing headers: X-Signature"},
+		{"GET", "/versioned?v=v9", http.StatusNotAcceptable, `custom Not Acceptable: unsupported API version "v9"`},
+		{"GET", "/limited", http.StatusTooManyRequests, "custom Too Many Requests: "},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(e.method, e.path, strings.NewReader("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "text/plain")
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.path, resp.Code, "≠", e.status)
+		}
+		if resp.Body.String() != e.body {
+			t.Error("unexpected body for", e.path, resp.Body.String(), "≠", e.body)
+		}
+	}
+
+	// outside of kami
+	resp := httptest.NewRecorder()
+	kami.ClientError(context.Background(), resp, http.StatusBadRequest, "nope")
+	if resp.Code != http.StatusBadRequest || resp.Body.String() != "Bad Request: nope\n" {
+		t.Error("unexpected fallback:", resp.Code, resp.Body.String())
+	}
+}
@@ -0,0 +1,59 @@
+package kami
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"golang.org/x/net/context"
+)
+
+// PanicReport describes a recovered panic, for sending to error trackers like Sentry or Rollbar.
+type PanicReport struct {
+	// Value is the "v" in panic(v).
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack  []byte
+	Method string
+	Path   string
+	// RequestID is the ID from the RequestID middleware, or failing that,
+	// the X-Request-Id header of the request or the response.
+	RequestID string
+	// Header is a copy of the request headers, without SanitizeHeaders.
+	Header http.Header
+}
+
+var (
+	// OnPanicReport will, if set, be called with a report of every panic, before PanicHandler.
+	// If neither PanicHandler nor LogHandler are set, panics are recovered and answered with a 500 error.
+	OnPanicReport func(PanicReport)
+	// SanitizeHeaders are removed from the headers in a PanicReport.
+	SanitizeHeaders = []string{"Authorization", "Cookie"}
+)
+
+func newPanicReport(ctx context.Context, v interface{}, w http.ResponseWriter, r *http.Request) PanicReport {
+	id := RequestIDFrom(ctx)
+	if id == "" {
+		id = r.Header.Get("X-Request-Id")
+	}
+	if id == "" {
+		id = w.Header().Get("X-Request-Id")
+	}
+
+	return PanicReport{
+		Value:     v,
+		Stack:     debug.Stack(),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		RequestID: id,
+		Header:    sanitizeHeader(r.Header),
+	}
+}
+
+// sanitizeHeader returns a copy of h without SanitizeHeaders.
+func sanitizeHeader(h http.Header) http.Header {
+	header := cloneHeader(h)
+	for _, k := range SanitizeHeaders {
+		header.Del(k)
+	}
+	return header
+}
@@ -0,0 +1,106 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestOnPanicReport(t *testing.T) {
+	kami.Reset()
+	defer kami.Reset()
+
+	var reports []kami.PanicReport
+	kami.OnPanicReport = func(report kami.PanicReport) {
+		reports = append(reports, report)
+	}
+	kami.Get("/boom/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/boom/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-Id", "abc123")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("User-Agent", "kami-test")
+
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusInternalServerError {
+		t.Error("should return HTTP StatusInternalServerError(500)", resp.Code, "≠", http.StatusInternalServerError)
+	}
+	if len(reports) != 1 {
+		t.Fatal("expected 1 report, got", len(reports))
+	}
+
+	report := reports[0]
+	if report.Value != "boom" {
+		t.Error("unexpected value:", report.Value)
+	}
+	if report.Method != "GET" || report.Path != "/boom/1" || report.RequestID != "abc123" {
+		t.Error("unexpected request metadata:", report.Method, report.Path, report.RequestID)
+	}
+	if !strings.Contains(string(report.Stack), "panic") {
+		t.Error("stack should include the panic:", string(report.Stack))
+	}
+	if report.Header.Get("Authorization") != "" || report.Header.Get("Cookie") != "" {
+		t.Error("sensitive headers should be stripped:", report.Header)
+	}
+	if report.Header.Get("User-Agent") != "kami-test" {
+		t.Error("other headers should be kept:", report.Header)
+	}
+	if req.Header.Get("Authorization") == "" {
+		t.Error("request headers shouldn't be modified")
+	}
+
+	// PanicHandler still renders the response
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	resp = httptest.NewRecorder()
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusTeapot {
+		t.Error("should return HTTP StatusTeapot(418)", resp.Code, "≠", http.StatusTeapot)
+	}
+	if len(reports) != 2 {
+		t.Error("expected 2 reports, got", len(reports))
+	}
+}
+
+func TestPanicReportRequestID(t *testing.T) {
+	kami.Reset()
+	defer kami.Reset()
+
+	var report kami.PanicReport
+	kami.OnPanicReport = func(r kami.PanicReport) {
+		report = r
+	}
+	kami.UseOutermost(kami.RequestID())
+	kami.Get("/boom", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/boom", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// too long, so RequestID makes a new one
+	req.Header.Set("X-Request-Id", strings.Repeat("x", 200))
+	kami.Handler().ServeHTTP(resp, req)
+	id := resp.Header().Get("X-Request-Id")
+	if id == "" || len(id) >= 200 {
+		t.Fatal("RequestID should replace the overlong ID:", id)
+	}
+	if report.RequestID != id {
+		t.Error("report should have the ID from RequestID", report.RequestID, "≠", id)
+	}
+}
@@ -0,0 +1,42 @@
+package kami
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// maxRequestIDLen is the longest X-Request-Id RequestID will accept from a client.
+const maxRequestIDLen = 128
+
+// RequestID returns middleware that gives each request an ID for correlating logs.
+// It uses the request's X-Request-Id header if there is one, or else generates a random ID,
+// and sends it back in the X-Request-Id response header. Get it with RequestIDFrom.
+// RequestID is best registered with UseOutermost, so the ID is there for everything else,
+// including PanicHandler, LogHandler, and OnPanicReport when a panic happens in other middleware.
+func RequestID() Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		id := r.Header.Get("X-Request-Id")
+		if id == "" || len(id) > maxRequestIDLen {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-Id", id)
+		return context.WithValue(ctx, requestIDKey, id)
+	}
+}
+
+// RequestIDFrom returns the ID given to the request by RequestID, or a blank string.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf[:])
+}
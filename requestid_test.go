@@ -0,0 +1,87 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestRequestID(t *testing.T) {
+	kami.Reset()
+	kami.UseOutermost(kami.RequestID())
+	var got string
+	kami.Get("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		got = kami.RequestIDFrom(ctx)
+	})
+
+	// generated
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if len(got) != 32 || resp.Header().Get("X-Request-Id") != got {
+		t.Error("unexpected generated ID:", got, resp.Header().Get("X-Request-Id"))
+	}
+
+	// from the client
+	resp = httptest.NewRecorder()
+	req.Header.Set("X-Request-Id", "abc123")
+	kami.Handler().ServeHTTP(resp, req)
+	if got != "abc123" || resp.Header().Get("X-Request-Id") != "abc123" {
+		t.Error("should use the client's ID:", got, resp.Header().Get("X-Request-Id"))
+	}
+}
+
+func TestRequestIDPanic(t *testing.T) {
+	explode := func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		panic("boom")
+	}
+
+	var ids []string
+	setup := func() {
+		kami.Reset()
+		kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if kami.Exception(ctx) != "boom" {
+				t.Error("unexpected exception:", kami.Exception(ctx))
+			}
+			ids = append(ids, kami.RequestIDFrom(ctx))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		kami.Get("/", noop)
+	}
+
+	for _, register := range []func(){
+		// outermost, with a panic in global middleware
+		func() {
+			kami.UseOutermost(kami.RequestID())
+			kami.Use("/", explode)
+		},
+		// in the same chain as the middleware that panics
+		func() {
+			kami.Use("/", kami.RequestID())
+			kami.Use("/", explode)
+		},
+	} {
+		setup()
+		register()
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Request-Id", "abc123")
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != http.StatusInternalServerError {
+			t.Error("should return HTTP StatusInternalServerError(500)", resp.Code, "≠", http.StatusInternalServerError)
+		}
+	}
+	if len(ids) != 2 || ids[0] != "abc123" || ids[1] != "abc123" {
+		t.Error("PanicHandler should see the request ID:", ids)
+	}
+}
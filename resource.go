@@ -0,0 +1,33 @@
+package kami
+
+import (
+	"golang.org/x/net/context"
+)
+
+// resourceKey wraps keys given to WithResource so they can't collide with other context values.
+type resourceKey struct {
+	key interface{}
+}
+
+// WithResource checks out a request-scoped resource, such as a pooled database connection or transaction,
+// and returns a context holding it, for use in middleware.
+// acquire is called right away, and the release function it returns (if not nil) is run automatically when the request is done,
+// as a finalizer (see Defer), so it runs even if the request panicked. Releases run in reverse order of checkout.
+// Get the resource back with Resource, using the same key.
+// WithResource panics if ctx didn't come from kami, because the resource would never be released.
+func WithResource(ctx context.Context, key interface{}, acquire func() (interface{}, func())) context.Context {
+	req := requestFrom(ctx)
+	if req == nil {
+		panic("kami: WithResource called with a context that didn't come from kami")
+	}
+	res, release := acquire()
+	if release != nil {
+		req.addFinalizer(release)
+	}
+	return context.WithValue(ctx, resourceKey{key}, res)
+}
+
+// Resource returns the resource checked out with WithResource for the given key, or nil if there isn't one.
+func Resource(ctx context.Context, key interface{}) interface{} {
+	return ctx.Value(resourceKey{key})
+}
@@ -0,0 +1,82 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+type conn struct {
+	id       int
+	released bool
+}
+
+func TestResource(t *testing.T) {
+	var checkedOut []*conn
+	var order []int
+	pool := func(id int) func() (interface{}, func()) {
+		return func() (interface{}, func()) {
+			c := &conn{id: id}
+			checkedOut = append(checkedOut, c)
+			return c, func() {
+				c.released = true
+				order = append(order, id)
+			}
+		}
+	}
+	checkout := func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		ctx = kami.WithResource(ctx, "db", pool(1))
+		return kami.WithResource(ctx, "cache", pool(2))
+	}
+
+	kami.Reset()
+	kami.Use("/", checkout)
+	kami.Get("/ok", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		c, ok := kami.Resource(ctx, "db").(*conn)
+		if !ok || c.id != 1 || c.released {
+			t.Error("handler should see a checked-out resource:", c)
+		}
+		if kami.Resource(ctx, "missing") != nil {
+			t.Error("unknown keys should return nil")
+		}
+	})
+	kami.Get("/panic", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	kami.PanicHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	for _, path := range []string{"/ok", "/panic"} {
+		checkedOut, order = nil, nil
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+
+		if len(checkedOut) != 2 {
+			t.Fatal("expected 2 resources to be checked out for", path, "got", len(checkedOut))
+		}
+		for _, c := range checkedOut {
+			if !c.released {
+				t.Error("resource should be released for", path, c.id)
+			}
+		}
+		if len(order) != 2 || order[0] != 2 || order[1] != 1 {
+			t.Error("resources should be released in reverse order for", path, order)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WithResource should panic outside of kami")
+		}
+	}()
+	kami.WithResource(context.Background(), "db", pool(3))
+}
@@ -0,0 +1,154 @@
+package kami
+
+import (
+	"encoding"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// ResultFn is a handler that returns its result for Result to send, instead of writing a response itself.
+type ResultFn func(ctx context.Context, r *http.Request) (interface{}, error)
+
+// NoContent can be returned by a ResultFn to respond with 204 No Content.
+var NoContent = noContent{}
+
+type noContent struct{}
+
+// Redirect can be returned by a ResultFn to redirect the client to URL.
+// Status defaults to 302 Found for GET and HEAD requests, and 303 See Other for others.
+type Redirect struct {
+	URL    string
+	Status int
+}
+
+// ErrorStatus picks the HTTP status for an error returned by a ResultFn.
+// By default, errors registered with MapError or MapErrorFunc use their mapped status,
+// then errors with a StatusCode() int method (including ones they wrap) use that status,
+// and anything else is a 500 Internal Server Error.
+var ErrorStatus func(err error) int = DefaultErrorStatus
+
+// errorMappings are checked by DefaultErrorStatus, in order.
+var errorMappings []func(error) (int, bool)
+
+// MapError makes DefaultErrorStatus use status for errors that match target with errors.Is,
+// including errors that wrap it, so domain errors can be turned into responses in one place:
+//
+//	kami.MapError(sql.ErrNoRows, http.StatusNotFound)
+//
+// Mappings are checked in the order they were registered, and the first match wins. Reset removes them.
+// Like Use, it isn't threadsafe, so call it before serving.
+func MapError(target error, status int) {
+	MapErrorFunc(func(err error) (int, bool) {
+		if errors.Is(err, target) {
+			return status, true
+		}
+		return 0, false
+	})
+}
+
+// MapErrorFunc is like MapError, but fn decides whether err matches and what its status is,
+// for things like matching an error type with errors.As.
+func MapErrorFunc(fn func(err error) (status int, ok bool)) {
+	errorMappings = append(errorMappings, fn)
+}
+
+// DefaultErrorStatus is the default ErrorStatus.
+func DefaultErrorStatus(err error) int {
+	for _, mapping := range errorMappings {
+		if status, ok := mapping(err); ok {
+			return status
+		}
+	}
+	var coded interface{ StatusCode() int }
+	if errors.As(err, &coded) {
+		return coded.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// Result adapts fn into a HandleFn that sends what fn returns.
+// Values are encoded as JSON by default, or as XML if the client's Accept header prefers it.
+// Strings, fmt.Stringers, and encoding.TextMarshalers can also be sent as text/plain.
+// If none of those are acceptable to the client, the response is 406 Not Acceptable.
+// Return NoContent for a 204 response, or a Redirect to redirect.
+// Errors are sent with ErrorRenderer using the status from ErrorStatus.
+// For client errors (4xx), the error's message is given as the ErrorDetail; other errors are logged instead, so they don't leak.
+func Result(fn ResultFn) HandleFn {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		v, err := fn(ctx, r)
+		if err != nil {
+			writeResultError(ctx, w, r, err)
+			return
+		}
+
+		switch v := v.(type) {
+		case noContent:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case Redirect:
+			code := v.Status
+			if code == 0 {
+				code = http.StatusFound
+				if r.Method != "GET" && r.Method != "HEAD" {
+					code = http.StatusSeeOther
+				}
+			}
+			http.Redirect(w, r, v.URL, code)
+			return
+		}
+
+		offers := []string{"application/json", "application/xml"}
+		text, isText := resultText(v)
+		if isText {
+			offers = append(offers, "text/plain")
+		}
+		switch negotiate(r, offers...) {
+		case "application/json":
+			err = JSON(w, http.StatusOK, v)
+		case "application/xml":
+			var data []byte
+			if data, err = xml.Marshal(v); err == nil {
+				w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+				w.Write([]byte(xml.Header))
+				w.Write(data)
+			}
+		case "text/plain":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(text))
+		default:
+			ClientError(ctx, w, http.StatusNotAcceptable, "")
+		}
+		if err != nil {
+			writeResultError(ctx, w, r, fmt.Errorf("kami: can't encode result: %w", err))
+		}
+	}
+}
+
+func writeResultError(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	status := ErrorStatus(err)
+	if status >= 400 && status < 500 {
+		ClientError(ctx, w, status, err.Error())
+		return
+	}
+	log.Printf("kami: error for %s %s: %v", r.Method, r.URL.Path, err)
+	renderError(ctx, w, r, status)
+}
+
+// resultText returns v as text, if it can be.
+func resultText(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		return string(text), err == nil
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return "", false
+}
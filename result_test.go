@@ -0,0 +1,151 @@
+package kami_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+type user struct {
+	Name string `json:"name" xml:"name"`
+}
+
+type notFoundError struct{ what string }
+
+func (e notFoundError) Error() string   { return e.what + " not found" }
+func (e notFoundError) StatusCode() int { return http.StatusNotFound }
+
+func TestResult(t *testing.T) {
+	kami.Reset()
+	kami.Get("/user", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return user{Name: "bob"}, nil
+	}))
+	kami.Get("/text", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return "hello", nil
+	}))
+	kami.Get("/missing", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return nil, fmt.Errorf("loading: %w", notFoundError{"user"})
+	}))
+	kami.Get("/broken", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return nil, errors.New("database password is hunter2")
+	}))
+	kami.Delete("/user", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return kami.NoContent, nil
+	}))
+	kami.Post("/user", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return kami.Redirect{URL: "/user"}, nil
+	}))
+	kami.Get("/old", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return kami.Redirect{URL: "/user", Status: http.StatusMovedPermanently}, nil
+	}))
+
+	expect := []struct {
+		method, path, accept string
+		status               int
+		contentType          string
+		body                 string
+	}{
+		{"GET", "/user", "", http.StatusOK, "application/json", `{"name":"bob"}`},
+		{"GET", "/user", "application/xml", http.StatusOK, "application/xml; charset=utf-8", `<?xml version="1.0" encoding="UTF-8"?>` + "\n<user><name>bob</name></user>"},
+		{"GET", "/user", "text/plain", http.StatusNotAcceptable, "text/plain; charset=utf-8", "Not Acceptable\n"},
+		{"GET", "/text", "text/plain", http.StatusOK, "text/plain; charset=utf-8", "hello"},
+		{"GET", "/text", "", http.StatusOK, "application/json", `"hello"`},
+		{"GET", "/missing", "", http.StatusNotFound, "text/plain; charset=utf-8", "Not Found: loading: user not found\n"},
+		{"GET", "/broken", "", http.StatusInternalServerError, "text/plain; charset=utf-8", "Internal Server Error\n"},
+		{"DELETE", "/user", "", http.StatusNoContent, "", ""},
+		{"POST", "/user", "", http.StatusSeeOther, "", ""},
+		{"GET", "/old", "", http.StatusMovedPermanently, "", ""},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(e.method, e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.accept != "" {
+			req.Header.Set("Accept", e.accept)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.method, e.path, e.accept, resp.Code, "≠", e.status)
+		}
+		if e.contentType != "" && resp.Header().Get("Content-Type") != e.contentType {
+			t.Error("unexpected Content-Type for", e.method, e.path, e.accept, resp.Header().Get("Content-Type"))
+		}
+		if e.body != "" && strings.TrimSpace(resp.Body.String()) != strings.TrimSpace(e.body) {
+			t.Error("unexpected body for", e.method, e.path, e.accept, resp.Body.String(), "≠", e.body)
+		}
+		if e.status >= 300 && e.status < 400 && resp.Header().Get("Location") != "/user" {
+			t.Error("unexpected Location for", e.method, e.path, resp.Header().Get("Location"))
+		}
+	}
+}
+
+type quotaError struct{ limit int }
+
+func (e *quotaError) Error() string { return fmt.Sprintf("over quota of %d", e.limit) }
+
+var errGone = errors.New("gone")
+
+func TestMapError(t *testing.T) {
+	kami.Reset()
+	kami.MapError(errGone, http.StatusGone)
+	kami.MapErrorFunc(func(err error) (int, bool) {
+		var quota *quotaError
+		if errors.As(err, &quota) {
+			return http.StatusTooManyRequests, true
+		}
+		return 0, false
+	})
+	// mappings win over StatusCode()
+	kami.MapError(notFoundError{"secret"}, http.StatusForbidden)
+	errs := map[string]error{
+		"/gone":    errGone,
+		"/wrapped": fmt.Errorf("loading: %w", fmt.Errorf("fetching: %w", errGone)),
+		"/quota":   fmt.Errorf("saving: %w", &quotaError{10}),
+		"/secret":  fmt.Errorf("loading: %w", notFoundError{"secret"}),
+		"/missing": notFoundError{"user"},
+		"/broken":  errors.New("boom"),
+	}
+	for path, err := range errs {
+		err := err
+		kami.Get(path, kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+			return nil, err
+		}))
+	}
+
+	expect := map[string]int{
+		"/gone":    http.StatusGone,
+		"/wrapped": http.StatusGone,
+		"/quota":   http.StatusTooManyRequests,
+		"/secret":  http.StatusForbidden,
+		"/missing": http.StatusNotFound,
+		"/broken":  http.StatusInternalServerError,
+	}
+	for path, want := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != want {
+			t.Error("unexpected status for", path, resp.Code, "≠", want)
+		}
+	}
+
+	// Reset removes mappings
+	kami.Reset()
+	if got := kami.DefaultErrorStatus(errGone); got != http.StatusInternalServerError {
+		t.Error("mappings should be removed by Reset", got)
+	}
+}
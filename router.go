@@ -0,0 +1,70 @@
+package kami
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Router is a routing backend for kami.
+// kami uses httprouter by default (see NewHTTPRouter), but any Router can be used with SetRouter,
+// for example one that supports regular expressions in paths.
+// Handlers, middleware, and URL params work the same no matter which Router is used.
+type Router interface {
+	// Handle registers handle for the given method and path.
+	// It should panic if the route can't be registered, like httprouter does.
+	Handle(method, path string, handle httprouter.Handle)
+	// Lookup returns the handler and params for the given method and path, or false if no route matches.
+	Lookup(method, path string) (httprouter.Handle, httprouter.Params, bool)
+	// NotFound sets the handler for requests that don't match any route.
+	NotFound(http.Handler)
+	// MethodNotAllowed sets the handler for requests that match a route, but not its method.
+	MethodNotAllowed(http.Handler)
+	// ServeHTTP calls the handler for the request's route, or the NotFound or MethodNotAllowed handler.
+	http.Handler
+}
+
+// newRouter makes an empty router, for Reset, Build, and so on.
+var newRouter = NewHTTPRouter
+
+// NewHTTPRouter returns a Router backed by httprouter, which is what kami uses by default.
+func NewHTTPRouter() Router {
+	return httpRouter{httprouter.New()}
+}
+
+// SetRouter makes kami use routers made by fn, and moves every registered route to a new one.
+// If any route can't be registered with the new router, SetRouter returns RegisterErrors and nothing changes.
+// If fn is nil, the default (NewHTTPRouter) is restored.
+func SetRouter(fn func() Router) error {
+	if fn == nil {
+		fn = NewHTTPRouter
+	}
+	prev := newRouter
+	newRouter = fn
+	router, errs := buildRouter(registered)
+	if errs != nil {
+		newRouter = prev
+		return errs
+	}
+	routes = router
+	return nil
+}
+
+// the NotFound and MethodNotAllowed fields are http.HandlerFuncs before httprouter v1.2 and http.Handlers after,
+// and an http.HandlerFunc can be assigned to either
+type httpRouter struct {
+	*httprouter.Router
+}
+
+func (hr httpRouter) Lookup(method, path string) (httprouter.Handle, httprouter.Params, bool) {
+	h, params, _ := hr.Router.Lookup(method, path)
+	return h, params, h != nil
+}
+
+func (hr httpRouter) NotFound(h http.Handler) {
+	hr.Router.NotFound = http.HandlerFunc(h.ServeHTTP)
+}
+
+func (hr httpRouter) MethodNotAllowed(h http.Handler) {
+	hr.Router.MethodNotAllowed = http.HandlerFunc(h.ServeHTTP)
+}
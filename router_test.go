@@ -0,0 +1,125 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+// regexRouter is a toy Router whose paths are regular expressions with named groups as params.
+type regexRouter struct {
+	routes           []regexRoute
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+type regexRoute struct {
+	method string
+	re     *regexp.Regexp
+	handle httprouter.Handle
+}
+
+func (rr *regexRouter) Handle(method, path string, handle httprouter.Handle) {
+	rr.routes = append(rr.routes, regexRoute{method, regexp.MustCompile("^" + path + "$"), handle})
+}
+
+func (rr *regexRouter) Lookup(method, path string) (httprouter.Handle, httprouter.Params, bool) {
+	for _, rt := range rr.routes {
+		if rt.method != method {
+			continue
+		}
+		if m := rt.re.FindStringSubmatch(path); m != nil {
+			var params httprouter.Params
+			for i, name := range rt.re.SubexpNames() {
+				if name != "" {
+					params = append(params, httprouter.Param{Key: name, Value: m[i]})
+				}
+			}
+			return rt.handle, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+func (rr *regexRouter) NotFound(h http.Handler)         { rr.notFound = h }
+func (rr *regexRouter) MethodNotAllowed(h http.Handler) { rr.methodNotAllowed = h }
+
+func (rr *regexRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, params, ok := rr.Lookup(r.Method, r.URL.Path); ok {
+		h(w, r, params)
+		return
+	}
+	for _, rt := range rr.routes {
+		if rt.re.MatchString(r.URL.Path) {
+			rr.methodNotAllowed.ServeHTTP(w, r)
+			return
+		}
+	}
+	rr.notFound.ServeHTTP(w, r)
+}
+
+func TestSetRouter(t *testing.T) {
+	kami.Reset()
+	defer kami.Reset()
+
+	// fails if the routes don't fit
+	kami.Get("/broken/(", noop)
+	if err := kami.SetRouter(func() kami.Router { return new(regexRouter) }); err == nil {
+		t.Error("regexRouter shouldn't accept an invalid regexp")
+	}
+	if _, _, ok := kami.Lookup("GET", "/broken/("); !ok {
+		t.Error("a failed SetRouter shouldn't change the router")
+	}
+
+	kami.Reset()
+	// registered before switching, so it has to move over
+	kami.Get(`/users/(?P<id>[0-9]+)`, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user " + kami.Param(ctx, "id")))
+	})
+	if err := kami.SetRouter(func() kami.Router { return new(regexRouter) }); err != nil {
+		t.Fatal(err)
+	}
+	kami.Get(`/users/(?P<name>[a-z]+)`, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("name " + kami.Param(ctx, "name")))
+	}, func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		w.Header().Set("X-Middleware", "ran")
+		return ctx
+	})
+
+	expect := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/users/42", http.StatusOK, "user 42"},
+		{"GET", "/users/bob", http.StatusOK, "name bob"},
+		{"GET", "/users/Bob", http.StatusNotFound, "Not Found\n"},
+		{"POST", "/users/42", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest(e.method, e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.method, e.path, resp.Code, "≠", e.status)
+		}
+		if resp.Body.String() != e.body {
+			t.Error("unexpected body for", e.method, e.path, resp.Body.String(), "≠", e.body)
+		}
+	}
+
+	if h, params, ok := kami.Lookup("GET", "/users/7"); !ok || h == nil || params.ByName("id") != "7" {
+		t.Error("Lookup should use the new router", ok, params)
+	}
+
+}
@@ -3,28 +3,76 @@ package kami
 import (
 	"flag"
 	"log"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/zenazn/goji/bind"
 	"github.com/zenazn/goji/graceful"
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func init() {
 	bind.WithFlag()
 }
 
+// ServeOption configures Serve and ServeListener.
+type ServeOption func(*serveConfig)
+
+type serveConfig struct {
+	h2c   bool
+	drain time.Duration
+}
+
+// WithH2C enables cleartext HTTP/2 (h2c), for use behind proxies that speak h2c to their backends.
+// HTTP/1.1 requests are still served normally.
+// Streaming with http.Flusher (such as SSE) works over h2c,
+// but HTTP/2 streams can't be hijacked, so websockets require an HTTP/1.1 connection.
+func WithH2C() ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.h2c = true
+	}
+}
+
+// WithDrainTimeout limits how long shutting down can take.
+// When the server stops, it waits for in-flight requests to finish, and then cancels the goroutines started with Go
+// and waits for them to return. After d, it gives up waiting.
+// By default, there's no limit.
+// With Serve and ServeListener, the timeout only applies to goroutines started with Go,
+// since requests are drained by Goji's graceful package.
+func WithDrainTimeout(d time.Duration) ServeOption {
+	return func(cfg *serveConfig) {
+		cfg.drain = d
+	}
+}
+
+// drainContext returns a context that's done after the drain timeout, if there is one.
+func (cfg serveConfig) drainContext() (context.Context, context.CancelFunc) {
+	if cfg.drain > 0 {
+		return context.WithTimeout(context.Background(), cfg.drain)
+	}
+	return context.WithCancel(context.Background())
+}
+
+var installRoot sync.Once
+
 // Serve starts kami with reasonable defaults.
 // It works (exactly) like Goji, looking for Einhorn, the bind flag, GOJI_BIND...
-func Serve() {
+func Serve(opts ...ServeOption) {
 	if !flag.Parsed() {
 		flag.Parse()
 	}
 
-	// Install our handler at the root of the standard net/http default mux.
-	// This allows packages like expvar to continue working as expected.
-	http.Handle("/", Handler())
+	ServeListener(bind.Default(), opts...)
+}
+
+// ServeListener is like Serve, but runs kami on the given listener.
+func ServeListener(listener net.Listener, opts ...ServeOption) {
+	handler, cfg := serveHandler(opts)
 
-	listener := bind.Default()
 	log.Println("Starting kami on", listener.Addr())
 
 	graceful.HandleSignals()
@@ -32,11 +80,80 @@ func Serve() {
 	graceful.PreHook(func() { log.Printf("kami received signal, gracefully stopping") })
 	graceful.PostHook(func() { log.Printf("kami stopped") })
 
-	err := graceful.Serve(listener, http.DefaultServeMux)
+	err := graceful.Serve(listener, handler)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	graceful.Wait()
+	drain, cancel := cfg.drainContext()
+	defer cancel()
+	StopGo(drain)
+}
+
+// ServeContext runs kami on the given TCP address until ctx is done, then gracefully shuts down.
+// If ctx is cancelled before the listener is bound, ServeContext returns ctx.Err() without binding.
+// It returns ctx.Err() after a shutdown caused by ctx, or the underlying http.Server error otherwise.
+// Unlike Serve, it doesn't look for Einhorn or install signal handlers, making it suitable for use with errgroup.
+func ServeContext(ctx context.Context, addr string, opts ...ServeOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	handler, cfg := serveHandler(opts)
+	srv := &http.Server{Handler: handler}
+	log.Println("Starting kami on", listener.Addr())
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		// closes the listener and waits for in-flight requests
+		drain, cancel := cfg.drainContext()
+		defer cancel()
+		if srv.Shutdown(drain) != nil {
+			srv.Close()
+		}
+		<-errc
+		StopGo(drain)
+		return ctx.Err()
+	}
+}
+
+// serveHandler installs kami into the default net/http mux and applies opts.
+func serveHandler(opts []ServeOption) (http.Handler, serveConfig) {
+	var cfg serveConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	// Install our handler at the root of the standard net/http default mux.
+	// This allows packages like expvar to continue working as expected.
+	// We look up the routes for every request so that Reset keeps working.
+	installRoot.Do(func() {
+		http.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Handler().ServeHTTP(w, r)
+		}))
+	})
+
+	var handler http.Handler = http.DefaultServeMux
+	if cfg.h2c {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	return handler, cfg
 }
@@ -0,0 +1,113 @@
+package kami_test
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/http2"
+
+	"github.com/guregu/kami"
+)
+
+func TestServeH2C(t *testing.T) {
+	kami.Reset()
+	kami.Get("/h2c", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go kami.ServeListener(listener, kami.WithH2C())
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	resp, err := client.Get("http://" + listener.Addr().String() + "/h2c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.StatusCode, "≠", http.StatusOK)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "HTTP/2.0" {
+		t.Error("expected HTTP/2.0, got", string(data))
+	}
+}
+
+func TestServeContext(t *testing.T) {
+	kami.Reset()
+	kami.Get("/ctx", noop)
+
+	// already cancelled: shouldn't bind at all
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := kami.ServeContext(ctx, "127.0.0.1:0"); err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+
+	// find a free port to serve on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- kami.ServeContext(ctx, addr)
+	}()
+
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp, err = http.Get("http://" + addr + "/ctx"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.StatusCode, "≠", http.StatusOK)
+	}
+
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("listener should be closed after cancellation")
+	}
+
+	// bind errors are returned as-is
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := kami.ServeContext(context.Background(), l.Addr().String()); err == nil {
+		t.Error("expected an error binding to a used address")
+	}
+}
@@ -0,0 +1,97 @@
+package kami
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// shadowClient sends shadow requests.
+var shadowClient = &http.Client{Timeout: 30 * time.Second}
+
+// maxShadowsInFlight caps the number of shadow requests being sent at once; more are dropped.
+const maxShadowsInFlight = 64
+
+var (
+	shadowSem   = make(chan struct{}, maxShadowsInFlight)
+	shadowStats struct {
+		sent, failed, dropped uint64
+	}
+)
+
+// Shadow returns middleware that mirrors a sample of requests to another backend, for testing a new version with real traffic.
+// A sampleRate of 0.1 mirrors about 10% of requests, and 1 mirrors all of them.
+// The mirrored request has the same method, path, query, headers, and body, and is sent asynchronously to target,
+// with the response thrown away. The body is buffered (see BufferBody) so the handler can still read it.
+// Shadow requests never delay or change the real response: errors are only counted (see ShadowStats),
+// and if too many shadow requests are already in flight, new ones are dropped.
+func Shadow(target *url.URL, sampleRate float64) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if sampleRate <= 0 || (sampleRate < 1 && rand.Float64() >= sampleRate) {
+			return ctx
+		}
+		body, err := BufferBody(r)
+		if err != nil {
+			atomic.AddUint64(&shadowStats.failed, 1)
+			return ctx
+		}
+		shadow := newShadowRequest(r, target, body)
+		select {
+		case shadowSem <- struct{}{}:
+		default:
+			atomic.AddUint64(&shadowStats.dropped, 1)
+			return ctx
+		}
+		go sendShadow(shadow)
+		return ctx
+	}
+}
+
+// ShadowStats returns how many shadow requests Shadow has sent successfully,
+// how many failed (couldn't be read or sent, or got a 5xx response), and how many were dropped because too many were in flight.
+func ShadowStats() (sent, failed, dropped uint64) {
+	return atomic.LoadUint64(&shadowStats.sent), atomic.LoadUint64(&shadowStats.failed), atomic.LoadUint64(&shadowStats.dropped)
+}
+
+func newShadowRequest(r *http.Request, target *url.URL, body []byte) *http.Request {
+	shadow := r.Clone(context.Background())
+	shadow.RequestURI = ""
+	shadow.URL.Scheme = target.Scheme
+	shadow.URL.Host = target.Host
+	shadow.URL.Path = strings.TrimRight(target.Path, "/") + r.URL.Path
+	shadow.URL.RawPath = ""
+	if target.RawQuery != "" && r.URL.RawQuery != "" {
+		shadow.URL.RawQuery = target.RawQuery + "&" + r.URL.RawQuery
+	} else if target.RawQuery != "" {
+		shadow.URL.RawQuery = target.RawQuery
+	}
+	shadow.Host = target.Host
+	shadow.Body = ioutil.NopCloser(bytes.NewReader(body))
+	shadow.ContentLength = int64(len(body))
+	shadow.Header.Del("Connection")
+	return shadow
+}
+
+func sendShadow(r *http.Request) {
+	defer func() { <-shadowSem }()
+	resp, err := shadowClient.Do(r)
+	if err != nil {
+		atomic.AddUint64(&shadowStats.failed, 1)
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		atomic.AddUint64(&shadowStats.failed, 1)
+		return
+	}
+	atomic.AddUint64(&shadowStats.sent, 1)
+}
@@ -0,0 +1,99 @@
+package kami_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestShadow(t *testing.T) {
+	mirrored := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		mirrored <- r.Method + " " + r.URL.RequestURI() + " " + r.Header.Get("X-Test") + " " + string(data)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ignored"))
+	}))
+	defer backend.Close()
+	target, err := url.Parse(backend.URL + "/v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL, _ := url.Parse(dead.URL)
+	dead.Close()
+
+	kami.Reset()
+	echo := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte("primary " + string(data)))
+	}
+	kami.Post("/echo", echo, kami.Shadow(target, 1))
+	kami.Post("/dead", echo, kami.Shadow(deadURL, 1))
+	kami.Post("/never", echo, kami.Shadow(target, 0))
+
+	do := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", path+"?x=1", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Test", "yes")
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	sent, failed, _ := kami.ShadowStats()
+	start := time.Now()
+	resp := do("/echo")
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Error("shadow request shouldn't delay the response:", elapsed)
+	}
+	if resp.Code != http.StatusOK || resp.Body.String() != "primary hello" {
+		t.Error("primary response should be unaffected:", resp.Code, resp.Body.String())
+	}
+	select {
+	case got := <-mirrored:
+		if want := "POST /v2/echo?x=1 yes hello"; got != want {
+			t.Error("unexpected shadow request:", got, "≠", want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request should be mirrored")
+	}
+
+	resp = do("/dead")
+	if resp.Code != http.StatusOK || resp.Body.String() != "primary hello" {
+		t.Error("shadow errors shouldn't affect the response:", resp.Code, resp.Body.String())
+	}
+
+	resp = do("/never")
+	if resp.Code != http.StatusOK || resp.Body.String() != "primary hello" {
+		t.Error("primary response should be unaffected:", resp.Code, resp.Body.String())
+	}
+	select {
+	case got := <-mirrored:
+		t.Error("request with a sample rate of 0 shouldn't be mirrored:", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if s, f, _ := kami.ShadowStats(); s > sent && f > failed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s, f, _ := kami.ShadowStats()
+	t.Error("stats should count the sent and failed shadow requests:", sent, "→", s, failed, "→", f)
+}
@@ -0,0 +1,174 @@
+package kami
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sync/singleflight"
+)
+
+// SingleFlightOption configures SingleFlight.
+type SingleFlightOption func(*flightGroup)
+
+// SingleFlightMaxSize sets the largest response body that SingleFlight will buffer and share.
+// The default is 1MB.
+func SingleFlightMaxSize(n int) SingleFlightOption {
+	return func(g *flightGroup) {
+		g.maxSize = n
+	}
+}
+
+type flightGroup struct {
+	group   singleflight.Group
+	keyFn   func(*http.Request) string
+	maxSize int
+}
+
+// errNotShared means the leader's response couldn't be shared.
+var errNotShared = errors.New("kami: response not shared")
+
+// SingleFlight returns middleware that coalesces concurrent requests with the same key.
+// The first request (the leader) runs as usual, while its response is buffered.
+// Requests that arrive with the same key while it is running wait for it and get a copy of its response,
+// skipping the rest of the middleware chain and the handler.
+// Requests with a blank key aren't coalesced.
+// Since waiting requests skip the rest of the chain and get the leader's response as-is,
+// the key must include everything that can change the response, such as credentials, cookies, and Accept,
+// and SingleFlight should be registered after auth middleware, so requests that fail auth never get a shared response.
+// If the leader panics, flushes (streams) its response, or writes more than the maximum size,
+// waiting requests run the handler themselves instead.
+func SingleFlight(keyFn func(r *http.Request) string, opts ...SingleFlightOption) Middleware {
+	g := &flightGroup{keyFn: keyFn, maxSize: 1 << 20}
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		key := g.keyFn(r)
+		if key == "" {
+			return ctx
+		}
+
+		fw := &flightWriter{ResponseWriter: w, ctx: ctx, max: g.maxSize, done: make(chan struct{})}
+		started := make(chan struct{})
+		results := g.group.DoChan(key, func() (interface{}, error) {
+			close(started)
+			<-fw.done
+			if fw.err != nil {
+				return nil, fw.err
+			}
+			return &fw.resp, nil
+		})
+
+		select {
+		case <-started:
+			// leader
+			SetWriter(ctx, fw)
+			// in case we panic without kami recovering
+			Defer(ctx, func() { fw.finish(errNotShared) })
+			return ctx
+		case res := <-results:
+			if res.Err != nil {
+				return ctx
+			}
+			res.Val.(*flightResponse).replay(w)
+			return Halt(ctx)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// flightResponse is a buffered response shared with followers.
+type flightResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (resp *flightResponse) replay(w http.ResponseWriter) {
+	h := w.Header()
+	for k, v := range resp.header {
+		h[k] = append([]string(nil), v...)
+	}
+	if resp.status != 0 {
+		w.WriteHeader(resp.status)
+	}
+	w.Write(resp.body)
+}
+
+// flightWriter records the leader's response while sending it.
+type flightWriter struct {
+	http.ResponseWriter
+	ctx  context.Context
+	max  int
+	resp flightResponse
+	// tooBig is set once the response can't be shared.
+	tooBig bool
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func (fw *flightWriter) WriteHeader(code int) {
+	if fw.resp.status == 0 {
+		fw.resp.status = code
+		fw.resp.header = cloneHeader(fw.Header())
+	}
+	fw.ResponseWriter.WriteHeader(code)
+}
+
+func (fw *flightWriter) Write(p []byte) (int, error) {
+	if fw.resp.status == 0 {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if !fw.tooBig {
+		if len(fw.resp.body)+len(p) > fw.max {
+			fw.tooBig = true
+			fw.resp.body = nil
+		} else {
+			fw.resp.body = append(fw.resp.body, p...)
+		}
+	}
+	return fw.ResponseWriter.Write(p)
+}
+
+// Flush means the response is being streamed, so it isn't shared.
+func (fw *flightWriter) Flush() {
+	fw.tooBig = true
+	fw.resp.body = nil
+	if f, ok := fw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close is called after the handler and hands the response to any followers.
+func (fw *flightWriter) Close() error {
+	if fw.tooBig || Exception(fw.ctx) != nil {
+		fw.finish(errNotShared)
+		return nil
+	}
+	if fw.resp.header == nil {
+		fw.resp.header = cloneHeader(fw.Header())
+	}
+	fw.finish(nil)
+	return nil
+}
+
+func (fw *flightWriter) finish(err error) {
+	fw.once.Do(func() {
+		fw.err = err
+		close(fw.done)
+	})
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h))
+	for k, v := range h {
+		h2[k] = append([]string(nil), v...)
+	}
+	return h2
+}
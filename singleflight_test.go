@@ -0,0 +1,126 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestSingleFlight(t *testing.T) {
+	kami.Reset()
+	byPath := func(r *http.Request) string { return r.URL.Path }
+	kami.Use("/report/", kami.SingleFlight(byPath, kami.SingleFlightMaxSize(16)))
+
+	var computed int32
+	release := make(chan struct{})
+	kami.Get("/report/:name", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&computed, 1)
+		<-release
+		w.Header().Set("X-Report", kami.Param(ctx, "name"))
+		w.WriteHeader(http.StatusAccepted)
+		if kami.Param(ctx, "name") == "huge" {
+			io.WriteString(w, strings.Repeat("x", 32))
+			return
+		}
+		io.WriteString(w, "done")
+	})
+
+	run := func(path string, n int) []*httptest.ResponseRecorder {
+		resps := make([]*httptest.ResponseRecorder, n)
+		var wg sync.WaitGroup
+		for i := range resps {
+			resps[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(resp *httptest.ResponseRecorder) {
+				defer wg.Done()
+				req, _ := http.NewRequest("GET", path, nil)
+				kami.Handler().ServeHTTP(resp, req)
+			}(resps[i])
+		}
+		// give everyone a chance to pile up behind the leader
+		for atomic.LoadInt32(&computed) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		return resps
+	}
+
+	resps := run("/report/daily", 5)
+	if computed != 1 {
+		t.Error("handler should run once, ran", computed)
+	}
+	for _, resp := range resps {
+		if resp.Code != http.StatusAccepted {
+			t.Error("should return HTTP StatusAccepted(202)", resp.Code, "≠", http.StatusAccepted)
+		}
+		if resp.Header().Get("X-Report") != "daily" || resp.Body.String() != "done" {
+			t.Error("unexpected response:", resp.Header(), resp.Body.String())
+		}
+	}
+
+	// too big to share: everyone runs the handler
+	computed = 0
+	release = make(chan struct{})
+	resps = run("/report/huge", 3)
+	if computed != 3 {
+		t.Error("handler should run for every request, ran", computed)
+	}
+	for _, resp := range resps {
+		if resp.Body.Len() != 32 {
+			t.Error("unexpected body:", resp.Body.String())
+		}
+	}
+}
+
+func TestSingleFlightAuth(t *testing.T) {
+	kami.Reset()
+	byAuth := func(r *http.Request) string { return r.URL.Path + " " + r.Header.Get("Authorization") }
+	kami.Use("/me", kami.SingleFlight(byAuth))
+	kami.Use("/me", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if r.Header.Get("Authorization") != "Bearer alice" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil
+		}
+		return ctx
+	})
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	kami.Get("/me", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		io.WriteString(w, "alice's secrets")
+	})
+
+	get := func(auth string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", auth)
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	leader := make(chan *httptest.ResponseRecorder)
+	go func() {
+		leader <- get("Bearer alice")
+	}()
+	<-entered
+	// the leader is in flight, but this key is different, so it goes through auth
+	if resp := get("Bearer mallory"); resp.Code != http.StatusUnauthorized || resp.Body.String() != "" {
+		t.Error("an unauthenticated request shouldn't get the leader's response:", resp.Code, resp.Body.String())
+	}
+	close(release)
+	if resp := <-leader; resp.Body.String() != "alice's secrets" {
+		t.Error("unexpected response for the leader:", resp.Body.String())
+	}
+}
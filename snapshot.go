@@ -0,0 +1,93 @@
+package kami
+
+import (
+	"github.com/julienschmidt/httprouter"
+)
+
+// Snapshot saves kami's global state (Context, handlers, routes, the Router, middleware, afterware, fallbacks, rewrites, the base path,
+// and settings like ErrorRenderer and DumpOutput) and returns a function that restores it.
+// This lets a test register its own routes and middleware with defer kami.Snapshot()(),
+// without affecting the tests that come after it.
+// kami's state is still global, so tests using Snapshot can't run in parallel with each other.
+func Snapshot() func() {
+	var (
+		ctx       = Context
+		panicky   = PanicHandler
+		logger    = LogHandler
+		reporter  = OnPanicReport
+		sanitize  = append([]string(nil), SanitizeHeaders...)
+		nf        = notFound
+		mna       = methodNotAllowed
+		backend   = newRouter
+		regs      = registered[:len(registered):len(registered)]
+		mw        = make(map[string][]Middleware, len(middleware))
+		aw        = make(map[string][]Afterware, len(afterware))
+		fb        = make(map[string]httprouter.Handle, len(fallbacks))
+		outer     = append([]Middleware(nil), outermost...)
+		inner     = append([]Middleware(nil), innermost...)
+		base      = basePath
+		rewrites  = append(rewriters[:0:0], rewriters...)
+		docBook   = make(map[string]RouteDoc, len(docs))
+		info      = APIInfo
+		deferred  = DeferRegistration
+		resetter  = ResetFunc
+		encoder   = newEncoder
+		unmarshal = jsonUnmarshal
+		marshal   = jsonMarshal
+		timeline  = timelineEnabled
+		tmpl      = templates
+		bags      = ErrorBagRenderer
+		mappings  = errorMappings[:len(errorMappings):len(errorMappings)]
+		status    = ErrorStatus
+		renderer  = ErrorRenderer
+		dump      = DumpOutput
+	)
+	for path, chain := range middleware {
+		mw[path] = append([]Middleware(nil), chain...)
+	}
+	for path, chain := range afterware {
+		aw[path] = append([]Afterware(nil), chain...)
+	}
+	for prefix, h := range fallbacks {
+		fb[prefix] = h
+	}
+	for k, doc := range docs {
+		docBook[k] = doc
+	}
+
+	return func() {
+		Context = ctx
+		PanicHandler = panicky
+		LogHandler = logger
+		OnPanicReport = reporter
+		SanitizeHeaders = sanitize
+		notFound = nf
+		middleware = mw
+		afterware = aw
+		fallbacks = fb
+		outermost = outer
+		innermost = inner
+		basePath = base
+		rewriters = rewrites
+		docs = docBook
+		APIInfo = info
+		DeferRegistration = deferred
+		ResetFunc = resetter
+		newEncoder = encoder
+		jsonUnmarshal = unmarshal
+		jsonMarshal = marshal
+		timelineEnabled = timeline
+		templates = tmpl
+		ErrorBagRenderer = bags
+		errorMappings = mappings
+		ErrorStatus = status
+		ErrorRenderer = renderer
+		DumpOutput = dump
+		methodNotAllowed = mna
+		newRouter = backend
+
+		// routes can't be removed from a router, so build a new one
+		routes, _ = buildRouter(regs)
+		registered = regs
+	}
+}
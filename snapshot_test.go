@@ -0,0 +1,163 @@
+package kami_test
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestSnapshot(t *testing.T) {
+	kami.Reset()
+	kami.Get("/kept", noop)
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		w.Header().Set("X-Kept", "1")
+		return ctx
+	})
+
+	restore := kami.Snapshot()
+	kami.Get("/temp", noop)
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		w.Header().Set("X-Temp", "1")
+		return ctx
+	})
+	kami.PanicHandler = noop
+
+	get := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := get("/temp"); resp.Code != http.StatusOK || resp.Header().Get("X-Temp") != "1" {
+		t.Error("temporary route should work before restoring", resp.Code, resp.Header())
+	}
+
+	restore()
+	if resp := get("/temp"); resp.Code != http.StatusNotFound {
+		t.Error("should return HTTP StatusNotFound(404)", resp.Code, "≠", http.StatusNotFound)
+	}
+	resp := get("/kept")
+	if resp.Code != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+	}
+	if resp.Header().Get("X-Kept") != "1" || resp.Header().Get("X-Temp") != "" {
+		t.Error("unexpected middleware after restoring:", resp.Header())
+	}
+	if kami.PanicHandler != nil {
+		t.Error("PanicHandler should be restored")
+	}
+
+	// routes registered after restoring don't conflict with the temporary ones
+	kami.Get("/temp", noop)
+}
+
+func TestSnapshotSettings(t *testing.T) {
+	kami.Reset()
+	get := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+	kami.Get("/fail", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return nil, errors.New("failed")
+	}))
+
+	kami.MapError(errGone, http.StatusGone)
+	kami.Get("/gone", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return nil, errGone
+	}))
+	kami.Get("/canceled", kami.Result(func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return nil, context.Canceled
+	}))
+	kami.Get("/invalid", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		bag := kami.Errors(ctx)
+		bag.Add("name", "is required")
+		bag.Render(w)
+	})
+	kami.SetTemplates(template.Must(template.New("page").Parse("kept")))
+	kami.Get("/page", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Render(ctx, w, http.StatusOK, "page", nil)
+	})
+	var spans int
+	kami.Use("/spans", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		return ctx
+	})
+	kami.Get("/spans", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		spans = len(kami.Timeline(ctx))
+	})
+	kami.Get("/json", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.JSON(w, http.StatusOK, 1)
+	})
+	dumpOutput := kami.DumpOutput
+	restore := kami.Snapshot()
+	kami.ErrorRenderer = func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int) {
+		w.WriteHeader(status)
+		io.WriteString(w, "custom")
+	}
+	kami.ErrorStatus = func(err error) int { return http.StatusServiceUnavailable }
+	if resp := get("/fail"); resp.Code != http.StatusServiceUnavailable || resp.Body.String() != "custom" {
+		t.Error("custom settings should be used before restoring", resp.Code, resp.Body.String())
+	}
+
+	kami.MapError(context.Canceled, http.StatusTeapot)
+	kami.ErrorBagRenderer = func(w http.ResponseWriter, status int, errs kami.BindErrors) {
+		io.WriteString(w, "custom")
+	}
+	kami.SetTemplates(template.Must(template.New("page").Parse("temp")))
+	kami.EnableTimeline()
+	kami.SetJSONCodec(func(v interface{}) ([]byte, error) { return []byte("custom"), nil }, nil)
+	kami.SetJSONEncoder(func(w io.Writer) kami.JSONEncoder { return nil })
+	kami.ResetFunc = func() context.Context { return context.WithValue(context.Background(), "temp", true) }
+	kami.DumpOutput = io.Discard
+	restore()
+	if resp := get("/missing"); resp.Body.String() == "custom" {
+		t.Error("ErrorRenderer should be restored")
+	}
+	if resp := get("/fail"); resp.Code != http.StatusInternalServerError {
+		t.Error("ErrorStatus should be restored", resp.Code, "≠", http.StatusInternalServerError)
+	}
+	if resp := get("/gone"); resp.Code != http.StatusGone {
+		t.Error("error mappings should be restored", resp.Code, "≠", http.StatusGone)
+	}
+	if resp := get("/canceled"); resp.Code != http.StatusInternalServerError {
+		t.Error("error mappings should be restored", resp.Code, "≠", http.StatusInternalServerError)
+	}
+	if resp := get("/invalid"); resp.Code != http.StatusUnprocessableEntity || resp.Body.String() == "custom" {
+		t.Error("ErrorBagRenderer should be restored", resp.Code, resp.Body.String())
+	}
+	if resp := get("/page"); resp.Body.String() != "kept" {
+		t.Error("templates should be restored", resp.Body.String())
+	}
+	get("/spans")
+	if spans != 0 {
+		t.Error("timeline should be disabled again after restoring", spans)
+	}
+	if resp := get("/json"); strings.TrimSpace(resp.Body.String()) != "1" {
+		t.Error("JSON codec should be restored", resp.Body.String())
+	}
+	if enc := kami.NewJSONEncoder(httptest.NewRecorder()); enc == nil {
+		t.Error("JSON encoder should be restored")
+	}
+	if kami.ResetFunc != nil {
+		t.Error("ResetFunc should be restored")
+	}
+	if kami.DumpOutput != dumpOutput {
+		t.Error("DumpOutput should be restored")
+	}
+}
@@ -0,0 +1,97 @@
+package kami
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Variant is one of the handlers a split route chooses between. See GetSplit.
+type Variant struct {
+	// Name identifies the variant in its cookie and VariantName. It should be unique and safe to put in a cookie.
+	Name string
+	// Weight is how often the variant is chosen, relative to the others.
+	// A variant with a weight of 0 isn't given to new visitors,
+	// and visitors who were assigned to it get assigned again.
+	Weight int
+	// Handler serves the variant.
+	Handler HandleFn
+}
+
+// GetSplit registers a GET handler under path that splits visitors between variants, for A/B testing.
+// Each visitor is picked a variant at random, in proportion to the weights,
+// so variants weighted 9 and 1 get 90% and 10% of visitors.
+// The choice is remembered with a cookie, so visitors keep getting the same variant while it's still around.
+// The chosen variant's name is available with VariantName, including to afterware and LogHandler.
+// Optionally, middleware that only applies to this route can be given, and runs after the variant is picked.
+// GetSplit panics if no variant has a positive weight.
+func GetSplit(path string, variants []Variant, mw ...Middleware) {
+	total := 0
+	for _, v := range variants {
+		if v.Weight > 0 {
+			total += v.Weight
+		}
+	}
+	if total == 0 {
+		panic("kami: GetSplit for " + path + " needs a variant with a positive weight")
+	}
+	variants = append([]Variant(nil), variants...)
+	cookieName := splitCookieName(path)
+
+	pick := func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if cookie, err := r.Cookie(cookieName); err == nil {
+			for i, v := range variants {
+				if v.Name == cookie.Value && v.Weight > 0 {
+					return context.WithValue(ctx, variantKey, &variants[i])
+				}
+			}
+		}
+		n := rand.Intn(total)
+		chosen := &variants[0]
+		for i, v := range variants {
+			if v.Weight <= 0 {
+				continue
+			}
+			if n < v.Weight {
+				chosen = &variants[i]
+				break
+			}
+			n -= v.Weight
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    chosen.Name,
+			Path:     "/",
+			MaxAge:   30 * 24 * 60 * 60,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return context.WithValue(ctx, variantKey, chosen)
+	}
+
+	handle := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ctx.Value(variantKey).(*Variant).Handler(ctx, w, r)
+	}
+	Get(path, handle, append([]Middleware{pick}, mw...)...)
+}
+
+// VariantName returns the name of the variant GetSplit chose for this request, or a blank string.
+func VariantName(ctx context.Context) string {
+	if v, ok := ctx.Value(variantKey).(*Variant); ok {
+		return v.Name
+	}
+	return ""
+}
+
+// splitCookieName returns the name of the cookie a split route uses, like kami_split_checkout for /checkout.
+func splitCookieName(path string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.Trim(path, "/"))
+	return "kami_split_" + name
+}
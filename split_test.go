@@ -0,0 +1,94 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestGetSplit(t *testing.T) {
+	kami.Reset()
+	variant := func(name string) kami.HandleFn {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, name+" "+kami.VariantName(ctx))
+		}
+	}
+	var logged string
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		logged = kami.VariantName(ctx)
+	}
+	kami.GetSplit("/checkout", []kami.Variant{
+		{Name: "a", Weight: 90, Handler: variant("A")},
+		{Name: "b", Weight: 10, Handler: variant("B")},
+		{Name: "off", Weight: 0, Handler: variant("OFF")},
+	})
+
+	get := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/checkout", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		return resp
+	}
+
+	// distribution
+	const n = 10000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		resp := get(nil)
+		counts[resp.Body.String()]++
+		if logged == "" {
+			t.Fatal("LogHandler should see the variant")
+		}
+	}
+	if counts["A a"]+counts["B b"] != n {
+		t.Fatal("unexpected responses", counts)
+	}
+	if b := counts["B b"]; b < n*8/100 || b > n*12/100 {
+		t.Error("variant b should get about 10% of requests, got", b, "of", n)
+	}
+
+	// sticky
+	resp := get(nil)
+	cookies := resp.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "kami_split_checkout" {
+		t.Fatal("expected a kami_split_checkout cookie", cookies)
+	}
+	first := resp.Body.String()
+	for i := 0; i < 100; i++ {
+		resp := get(cookies[0])
+		if resp.Body.String() != first {
+			t.Fatal("variant should stick to the cookie", resp.Body.String(), "≠", first)
+		}
+		if len(resp.Result().Cookies()) != 0 {
+			t.Fatal("the cookie shouldn't be set again")
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if resp := get(&http.Cookie{Name: "kami_split_checkout", Value: "b"}); resp.Body.String() != "B b" {
+			t.Fatal("variant b should stick to its cookie", resp.Body.String())
+		}
+	}
+
+	// variants that were turned off or removed get reassigned
+	for _, value := range []string{"off", "gone"} {
+		resp := get(&http.Cookie{Name: "kami_split_checkout", Value: value})
+		if body := resp.Body.String(); body != "A a" && body != "B b" {
+			t.Error("cookie for", value, "should be reassigned, got", body)
+		}
+		if len(resp.Result().Cookies()) != 1 {
+			t.Error("cookie for", value, "should be replaced")
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package kami
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// StaticOptions configures StaticWith.
+type StaticOptions struct {
+	// PreferPrecompressed serves file.js.br or file.js.gz instead of file.js, if one exists and the client accepts it,
+	// with Content-Encoding set and file.js's content type. Brotli is preferred over gzip.
+	// Otherwise, the original file is served as usual.
+	// Responses get Vary: Accept-Encoding, since they depend on it.
+	PreferPrecompressed bool
+}
+
+// precompressed lists the encodings checked by PreferPrecompressed, in order of preference, with their file extensions.
+var precompressed = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Static serves files from root for GET and HEAD requests matching pattern.
+// The pattern must end in a catch-all segment, which can have any name.
+// For example, Static("/assets/*path", http.Dir("public")) serves public/css/app.css for /assets/css/app.css.
+// An error is returned if the pattern doesn't end in a catch-all, or if the route can't be registered.
+func Static(pattern string, root http.FileSystem, mw ...Middleware) error {
+	return StaticWith(pattern, root, StaticOptions{}, mw...)
+}
+
+// StaticWith is like Static, with options.
+func StaticWith(pattern string, root http.FileSystem, opts StaticOptions, mw ...Middleware) error {
+	name, err := catchAllName(pattern)
+	if err != nil {
+		return err
+	}
+
+	files := http.FileServer(root)
+	handle := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = "/" + strings.TrimPrefix(Param(ctx, name), "/")
+		r2.URL = &u
+		if opts.PreferPrecompressed && servePrecompressed(w, r2, root) {
+			return
+		}
+		files.ServeHTTP(w, r2)
+	}
+
+	if err := HandleSafe("GET", pattern, handle, mw...); err != nil {
+		return err
+	}
+	return HandleSafe("HEAD", pattern, handle, mw...)
+}
+
+// servePrecompressed serves a compressed sibling of the requested file, if there's one the client accepts.
+// It returns false if it didn't, so the file should be served as usual.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, root http.FileSystem) bool {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if strings.HasSuffix(r.URL.Path, "/") {
+		return false
+	}
+	// like http.FileServer, so ../ can't escape root
+	name := path.Clean(r.URL.Path)
+	for _, pc := range precompressed {
+		if !acceptsEncoding(r, pc.encoding) {
+			continue
+		}
+		f, err := root.Open(name + pc.ext)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			f.Close()
+			continue
+		}
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			// sniffing would see the compressed data
+			ctype = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Content-Encoding", pc.encoding)
+		http.ServeContent(w, r, name, info.ModTime(), f)
+		f.Close()
+		return true
+	}
+	return false
+}
+
+// catchAllName returns the name of the catch-all parameter at the end of pattern.
+func catchAllName(pattern string) (string, error) {
+	i := strings.LastIndex(pattern, "/")
+	if i == -1 || !strings.HasPrefix(pattern[i+1:], "*") {
+		return "", fmt.Errorf("kami: static pattern %q must end in a catch-all like /*filepath", pattern)
+	}
+	name := pattern[i+2:]
+	if name == "" {
+		return "", fmt.Errorf("kami: static pattern %q has an unnamed catch-all", pattern)
+	}
+	return name, nil
+}
@@ -0,0 +1,152 @@
+package kami_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guregu/kami"
+)
+
+func TestStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "css", "app.css"), []byte("body{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	kami.Reset()
+	// :filepath is already taken elsewhere
+	kami.Get("/users/:filepath", noop)
+	if err := kami.Static("/assets/*path", http.Dir(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/assets/css/app.css", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.Code, "≠", http.StatusOK)
+	}
+	if body := resp.Body.String(); body != "body{}" {
+		t.Error("unexpected body:", body)
+	}
+
+	resp = httptest.NewRecorder()
+	req, err = http.NewRequest("GET", "/assets/missing.css", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotFound {
+		t.Error("should return HTTP StatusNotFound(404)", resp.Code, "≠", http.StatusNotFound)
+	}
+
+	for _, pattern := range []string{"/files", "/files/:name", "/files/*", "/files/*path/more"} {
+		if err := kami.Static(pattern, http.Dir(dir)); err == nil {
+			t.Error("expected an error for", pattern)
+		}
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	public := filepath.Join(dir, "public")
+	if err := os.MkdirAll(public, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("console.log(1)"))
+	zw.Close()
+	files := map[string][]byte{
+		filepath.Join(public, "app.js"):     []byte("console.log(1)"),
+		filepath.Join(public, "app.js.gz"):  gz.Bytes(),
+		filepath.Join(public, "app.js.br"):  []byte("fake brotli"),
+		filepath.Join(public, "plain.css"):  []byte("body{}"),
+		filepath.Join(dir, "secret.txt"):    []byte("secret"),
+		filepath.Join(dir, "secret.txt.gz"): []byte("secret"),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kami.Reset()
+	if err := kami.StaticWith("/assets/*path", http.Dir(public), kami.StaticOptions{PreferPrecompressed: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, accept string
+		encoding     string
+		body         string
+	}{
+		{"/assets/app.js", "gzip, deflate", "gzip", gz.String()},
+		{"/assets/app.js", "gzip, br", "br", "fake brotli"},
+		{"/assets/app.js", "br;q=0, gzip", "gzip", gz.String()},
+		{"/assets/app.js", "", "", "console.log(1)"},
+		{"/assets/plain.css", "gzip", "", "body{}"},
+	}
+	for _, test := range tests {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			req.Header.Set("Accept-Encoding", test.accept)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusOK {
+			t.Error("unexpected status for", test.path, test.accept, resp.Code)
+		}
+		if enc := resp.Header().Get("Content-Encoding"); enc != test.encoding {
+			t.Error("unexpected Content-Encoding for", test.path, test.accept, enc, "≠", test.encoding)
+		}
+		if resp.Body.String() != test.body {
+			t.Errorf("unexpected body for %s %s: %q", test.path, test.accept, resp.Body.String())
+		}
+		if ct := resp.Header().Get("Content-Type"); test.path == "/assets/app.js" && !strings.Contains(ct, "javascript") {
+			t.Error("should have the original file's Content-Type:", ct)
+		}
+		if vary := resp.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Error("unexpected Vary:", vary)
+		}
+	}
+
+	// can't escape the root, even for compressed siblings
+	for _, path := range []string{"/assets/../secret.txt", "/assets/%2e%2e/secret.txt", "/assets/..%2fsecret.txt"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		kami.Handler().ServeHTTP(resp, req)
+		if strings.Contains(resp.Body.String(), "secret") {
+			t.Error("directory traversal for", path, resp.Code, resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package kami
+
+import (
+	"golang.org/x/net/context"
+)
+
+// Tags are arbitrary metadata attached to a route, like Tags{"auth": "required", "cache": "60s"}.
+type Tags map[string]string
+
+// Route describes a registered route, as returned by Routes.
+type Route struct {
+	Method string
+	Path   string
+	// Tags are the route's tags, or nil if it has none.
+	Tags Tags
+}
+
+// HandleTagged is like Handle, but attaches tags to the route.
+// Every middleware (including ones registered with Use) and the handler can read them with RouteTags,
+// so middleware can change its behavior for particular routes.
+// The tags shouldn't be modified after registering the route.
+func HandleTagged(method, path string, handle HandleFn, tags Tags, mw ...Middleware) {
+	register(method, path, bless(handle, true, path, mw, tags, false), tags)
+}
+
+// GetTagged registers a GET handler with tags. See HandleTagged.
+func GetTagged(path string, handle HandleFn, tags Tags, mw ...Middleware) {
+	HandleTagged("GET", path, handle, tags, mw...)
+}
+
+// RouteTags returns the tags of the route that matched the request, or nil if it has none.
+func RouteTags(ctx context.Context) Tags {
+	if req := requestFrom(ctx); req != nil {
+		return req.tags
+	}
+	return nil
+}
+
+// Routes returns every registered route, in the order they were registered.
+func Routes() []Route {
+	list := make([]Route, len(registered))
+	for i, rt := range registered {
+		list[i] = Route{Method: rt.method, Path: rt.path, Tags: rt.tags}
+	}
+	return list
+}
@@ -0,0 +1,58 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestRouteTags(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if age := kami.RouteTags(ctx)["cache"]; age != "" {
+			w.Header().Set("Cache-Control", "max-age="+age)
+		}
+		return ctx
+	})
+	kami.GetTagged("/cached", noop, kami.Tags{"cache": "60"})
+	kami.Get("/plain", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if tags := kami.RouteTags(ctx); tags != nil {
+			t.Error("untagged routes shouldn't have tags:", tags)
+		}
+	})
+
+	expect := map[string]string{
+		"/cached": "max-age=60",
+		"/plain":  "",
+	}
+	for path, want := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kami.Handler().ServeHTTP(resp, req)
+		if got := resp.Header().Get("Cache-Control"); got != want {
+			t.Error("unexpected Cache-Control for", path, got, "≠", want)
+		}
+	}
+
+	want := []kami.Route{
+		{Method: "GET", Path: "/cached", Tags: kami.Tags{"cache": "60"}},
+		{Method: "GET", Path: "/plain"},
+	}
+	if routes := kami.Routes(); !reflect.DeepEqual(routes, want) {
+		t.Error("unexpected routes:", routes, "≠", want)
+	}
+
+	kami.Reset()
+	if routes := kami.Routes(); len(routes) != 0 {
+		t.Error("Reset should clear routes:", routes)
+	}
+}
@@ -0,0 +1,79 @@
+package kami
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/context"
+	"golang.org/x/text/language"
+)
+
+// templates is the template set used by Render.
+var templates *template.Template
+
+// SetTemplates sets the template set used by Render.
+// Reset clears it.
+func SetTemplates(t *template.Template) {
+	templates = t
+}
+
+// TemplateData is what Render passes to templates.
+// The data given to Render is in Data, so a template uses {{.Data.Name}} for its own values,
+// and things from the request's context are available as methods, such as
+// <script nonce="{{.Nonce}}">.
+type TemplateData struct {
+	Data interface{}
+	ctx  context.Context
+}
+
+// Context returns the request's context.
+func (td TemplateData) Context() context.Context {
+	return td.ctx
+}
+
+// RequestID returns the ID from the RequestID middleware, or a blank string if it didn't run.
+func (td TemplateData) RequestID() string {
+	return RequestIDFrom(td.ctx)
+}
+
+// Nonce returns the request's Nonce, the same one given to the Content-Security-Policy header.
+func (td TemplateData) Nonce() string {
+	return Nonce(td.ctx)
+}
+
+// Locale returns the locale chosen by the Locale middleware, or language.Und if it didn't run.
+func (td TemplateData) Locale() language.Tag {
+	return LocaleTag(td.ctx)
+}
+
+// Render executes the named template from SetTemplates and responds with it as HTML with the given status.
+// The template is rendered into a buffer first, so if it fails, nothing from it is sent:
+// the client gets a 500 error from ErrorRenderer instead, and the error is returned (for logging).
+// The template's data is a TemplateData holding data and the request's context.
+// Content-Type is set to text/html unless it already has been.
+func Render(ctx context.Context, w http.ResponseWriter, status int, name string, data interface{}) error {
+	err := errors.New("kami: no templates set (see SetTemplates)")
+	var buf bytes.Buffer
+	if templates != nil {
+		err = templates.ExecuteTemplate(&buf, name, TemplateData{Data: data, ctx: ctx})
+	}
+	if err != nil {
+		if req := requestFrom(ctx); req != nil && req.r != nil {
+			renderError(ctx, w, req.r, http.StatusInternalServerError)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return err
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
+	return err
+}
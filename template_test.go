@@ -0,0 +1,79 @@
+package kami_test
+
+import (
+	"html"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestRender(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(
+		`<p id="{{.RequestID}}">Hello, {{.Data.Name}}</p><script nonce="{{.Nonce}}"></script>`))
+	template.Must(tmpl.New("broken").Parse(`<p>before</p>{{.Data.Missing}}<p>after</p>`))
+
+	kami.Reset()
+	kami.SetTemplates(tmpl)
+	kami.Use("/", kami.RequestID())
+	var nonce string
+	var renderErr error
+	render := func(name string) kami.HandleFn {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			nonce = kami.Nonce(ctx)
+			renderErr = kami.Render(ctx, w, http.StatusCreated, name, struct{ Name string }{"<Ichigo>"})
+		}
+	}
+	kami.Get("/page", render("page"))
+	kami.Get("/broken", render("broken"))
+	kami.Get("/missing", render("missing"))
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-Id", "abc")
+	kami.Handler().ServeHTTP(resp, req)
+	if renderErr != nil {
+		t.Error(renderErr)
+	}
+	if resp.Code != http.StatusCreated {
+		t.Error("unexpected status:", resp.Code, "≠", http.StatusCreated)
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Error("unexpected Content-Type:", ct)
+	}
+	// the nonce can have characters like + that get escaped in attributes
+	want := `<p id="abc">Hello, <Ichigo></p><script nonce="` + nonce + `"></script>`
+	if html.UnescapeString(resp.Body.String()) != want {
+		t.Error("unexpected body:", resp.Body.String(), "≠", want)
+	}
+	if !strings.Contains(resp.Body.String(), "&lt;Ichigo&gt;") {
+		t.Error("data should be escaped:", resp.Body.String())
+	}
+
+	for _, path := range []string{"/broken", "/missing"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		renderErr = nil
+		kami.Handler().ServeHTTP(resp, req)
+		if renderErr == nil {
+			t.Error("Render should return the template error for", path)
+		}
+		if resp.Code != http.StatusInternalServerError {
+			t.Error("unexpected status for", path, resp.Code, "≠", http.StatusInternalServerError)
+		}
+		if strings.Contains(resp.Body.String(), "before") {
+			t.Error("partial output shouldn't be sent:", resp.Body.String())
+		}
+	}
+}
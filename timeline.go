@@ -0,0 +1,60 @@
+package kami
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Span is a part of a request's Timeline: one middleware, the handler, or one afterware.
+type Span struct {
+	// Phase is SpanMiddleware, SpanHandler, or SpanAfterware.
+	Phase string
+	// Path is the path the middleware or afterware was registered under,
+	// which is blank for UseOutermost and UseInnermost, or the route for handlers and route middleware.
+	Path string
+	// Name is the function's name, like github.com/you/app.auth.
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Phases of a Span.
+const (
+	SpanMiddleware = "middleware"
+	SpanHandler    = "handler"
+	SpanAfterware  = "afterware"
+)
+
+// timelineEnabled is set by EnableTimeline.
+var timelineEnabled bool
+
+// EnableTimeline makes kami record when each middleware, handler, and afterware starts and how long it takes,
+// for finding out where slow requests spend their time. Get the spans with Timeline.
+// It's off by default, and costs next to nothing while off. Reset turns it off again.
+// Like Use, it isn't threadsafe, so call it before serving.
+func EnableTimeline() {
+	timelineEnabled = true
+}
+
+// Timeline returns the spans recorded so far for the current request, in the order they finished,
+// or nil if EnableTimeline wasn't called.
+// Use it from afterware or LogHandler to see the whole request.
+func Timeline(ctx context.Context) []Span {
+	req := requestFrom(ctx)
+	if req == nil {
+		return nil
+	}
+	return append([]Span(nil), req.spans...)
+}
+
+// addSpan records a span for fn, which started at start and just finished.
+func (req *request) addSpan(phase, path string, fn interface{}, start time.Time) {
+	req.spans = append(req.spans, Span{
+		Phase:    phase,
+		Path:     path,
+		Name:     funcName(fn),
+		Start:    start,
+		Duration: time.Since(start),
+	})
+}
@@ -0,0 +1,89 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func slowMiddleware(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+	time.Sleep(10 * time.Millisecond)
+	return ctx
+}
+
+func quickMiddleware(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+	return ctx
+}
+
+func slowHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestTimeline(t *testing.T) {
+	var spans []kami.Span
+	logger := func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		spans = kami.Timeline(ctx)
+	}
+	setup := func() {
+		kami.Reset()
+		kami.LogHandler = logger
+		kami.Use("/", slowMiddleware)
+		kami.UseInnermost(quickMiddleware)
+		kami.After("/api/", func(ctx context.Context, w mutil.WriterProxy, r *http.Request) context.Context {
+			return ctx
+		})
+		kami.Get("/api/thing", slowHandler)
+	}
+	serve := func() {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/api/thing", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+	}
+
+	// off by default
+	setup()
+	serve()
+	if spans != nil {
+		t.Error("nothing should be recorded without EnableTimeline:", spans)
+	}
+
+	setup()
+	kami.EnableTimeline()
+	defer kami.Reset()
+	serve()
+
+	want := []struct {
+		phase, path, name string
+		min               time.Duration
+	}{
+		{kami.SpanMiddleware, "/", "slowMiddleware", 10 * time.Millisecond},
+		{kami.SpanMiddleware, "", "quickMiddleware", 0},
+		{kami.SpanHandler, "/api/thing", "slowHandler", 20 * time.Millisecond},
+		{kami.SpanAfterware, "/api/", "TestTimeline", 0},
+	}
+	if len(spans) != len(want) {
+		t.Fatal("unexpected spans:", spans)
+	}
+	for i, w := range want {
+		s := spans[i]
+		if s.Phase != w.phase || s.Path != w.path || !strings.Contains(s.Name, w.name) {
+			t.Error("unexpected span", i, s.Phase, s.Path, s.Name, "≠", w.phase, w.path, w.name)
+		}
+		if s.Duration < w.min || s.Duration > time.Second {
+			t.Error("implausible duration for", s.Name, s.Duration)
+		}
+		if i > 0 && s.Start.Before(spans[i-1].Start.Add(spans[i-1].Duration)) {
+			t.Error("spans should be in order:", spans[i-1], s)
+		}
+	}
+}
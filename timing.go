@@ -0,0 +1,100 @@
+package kami
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type timing struct {
+	name string
+	dur  time.Duration
+}
+
+// Timing records a named duration for the current request, to be sent by ServerTiming.
+// Names should be valid HTTP tokens, such as "auth" or "db".
+func Timing(ctx context.Context, name string, dur time.Duration) {
+	if req := requestFrom(ctx); req != nil {
+		req.timings = append(req.timings, timing{name: name, dur: dur})
+	}
+}
+
+// ServerTiming returns middleware that sends the durations recorded with Timing in a Server-Timing header.
+// The header is added just before the response is written, so it has everything recorded up until then,
+// such as timings from middleware and from the handler before it wrote anything.
+// Headers can't be added once the response has been written, so timings recorded after that
+// are dropped with a warning in the log.
+func ServerTiming() Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		req := requestFrom(ctx)
+		if req == nil {
+			return ctx
+		}
+		SetWriter(ctx, &timingWriter{ResponseWriter: w, req: req, r: r})
+		return ctx
+	}
+}
+
+// timingWriter adds the Server-Timing header before the response is written.
+type timingWriter struct {
+	http.ResponseWriter
+	req     *request
+	r       *http.Request
+	written bool
+	// sent is how many timings were in the header.
+	sent int
+}
+
+func (tw *timingWriter) addHeader() {
+	if tw.written {
+		return
+	}
+	tw.written = true
+	tw.sent = len(tw.req.timings)
+	if tw.sent > 0 {
+		tw.ResponseWriter.Header().Set("Server-Timing", formatTimings(tw.req.timings))
+	}
+}
+
+func (tw *timingWriter) WriteHeader(code int) {
+	tw.addHeader()
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timingWriter) Write(p []byte) (int, error) {
+	tw.addHeader()
+	return tw.ResponseWriter.Write(p)
+}
+
+func (tw *timingWriter) Flush() {
+	tw.addHeader()
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close adds the header to responses that were never written to,
+// and warns about timings that were recorded too late.
+func (tw *timingWriter) Close() error {
+	if !tw.written {
+		tw.addHeader()
+		return nil
+	}
+	if len(tw.req.timings) > tw.sent {
+		log.Printf("kami: can't send Server-Timing for %s %s: response already written", tw.r.Method, tw.r.URL.Path)
+	}
+	return nil
+}
+
+func formatTimings(timings []timing) string {
+	metrics := make([]string, len(timings))
+	for i, t := range timings {
+		ms := float64(t.dur) / float64(time.Millisecond)
+		metrics[i] = t.name + ";dur=" + strconv.FormatFloat(ms, 'f', -1, 64)
+	}
+	return strings.Join(metrics, ", ")
+}
@@ -0,0 +1,43 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestServerTiming(t *testing.T) {
+	kami.Reset()
+	kami.Use("/", kami.ServerTiming())
+	kami.Use("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		kami.Timing(ctx, "auth", 12*time.Millisecond+500*time.Microsecond)
+		return ctx
+	})
+	kami.Get("/quiet", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Timing(ctx, "db", 3*time.Millisecond)
+	})
+	kami.Get("/loud", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kami.Timing(ctx, "db", 3*time.Millisecond)
+		io.WriteString(w, "hello")
+		kami.Timing(ctx, "render", time.Millisecond)
+	})
+
+	for _, path := range []string{"/quiet", "/loud"} {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kami.Handler().ServeHTTP(resp, req)
+		// timings recorded after writing are too late
+		if got, want := resp.Result().Header.Get("Server-Timing"), "auth;dur=12.5, db;dur=3"; got != want {
+			t.Error("unexpected Server-Timing for", path, got, "≠", want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package kami
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"golang.org/x/net/context"
+)
+
+// Validator is implemented by types that can check themselves after being decoded by ValidateJSON.
+// Validate can return BindErrors or a FieldError to point out particular fields.
+type Validator interface {
+	Validate() error
+}
+
+var errRequired = errors.New("required")
+
+// ValidateJSON returns middleware that checks JSON request bodies by decoding them into a new value of schema's type.
+// schema is usually a struct, like ValidateJSON(CreateUser{}).
+// Fields tagged with validate:"required" must be present and not zero, and if the type implements Validator,
+// Validate is called as well.
+// If the body isn't valid, the request is rejected with 400 Bad Request and problem details listing each error under "errors".
+// Otherwise, the body is restored so the handler can read it again.
+// Requests with a body that isn't application/json are rejected with 415 Unsupported Media Type,
+// and requests without a body (such as most GETs) are skipped.
+func ValidateJSON(schema interface{}) Middleware {
+	typ := reflect.TypeOf(schema)
+	if typ == nil {
+		panic("kami: ValidateJSON needs a schema value, like ValidateJSON(CreateUser{})")
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if !hasBody(r) || r.Body == nil {
+			return ctx
+		}
+		if !contentTypeIs(r, []string{"application/json"}) {
+			ClientError(ctx, w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return nil
+		}
+
+		data, err := BufferBody(r)
+		if err != nil {
+			ClientError(ctx, w, http.StatusBadRequest, "can't read request body")
+			return nil
+		}
+		if errs := validateJSON(data, typ); len(errs) > 0 {
+			WriteFieldErrors(w, http.StatusBadRequest, errs)
+			return nil
+		}
+		return ctx
+	}
+}
+
+func validateJSON(data []byte, typ reflect.Type) BindErrors {
+	if len(data) == 0 {
+		return BindErrors{{Source: "body", Err: errors.New("missing")}}
+	}
+	v := reflect.New(typ)
+	if err := jsonUnmarshal(data, v.Interface()); err != nil {
+		fe := FieldError{Source: "body", Err: err}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			fe.Field = typeErr.Field
+		}
+		return BindErrors{fe}
+	}
+
+	var errs BindErrors
+	if typ.Kind() == reflect.Struct {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.Tag.Get("validate") == "required" && v.Elem().Field(i).IsZero() {
+				errs = append(errs, FieldError{Field: field.Name, Source: "body", Err: errRequired})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if validator, ok := v.Interface().(Validator); ok {
+		switch err := validator.Validate().(type) {
+		case nil:
+		case BindErrors:
+			errs = err
+		case FieldError:
+			errs = BindErrors{err}
+		default:
+			errs = BindErrors{{Source: "body", Err: err}}
+		}
+	}
+	return errs
+}
+
+type validationProblem struct {
+	ProblemDetails
+	Errors []fieldProblem `json:"errors"`
+}
+
+type fieldProblem struct {
+	Field  string `json:"field,omitempty"`
+	Source string `json:"source,omitempty"`
+	Error  string `json:"error"`
+}
+
+// WriteFieldErrors writes errs as an RFC 7807 problem details response with the given status,
+// listing each one in an "errors" array like:
+//
+//	{"field": "email", "source": "body", "error": "required"}
+//
+// It's used by ValidateJSON and is the default ErrorBagRenderer.
+func WriteFieldErrors(w http.ResponseWriter, status int, errs BindErrors) {
+	problem := validationProblem{
+		ProblemDetails: ProblemDetails{
+			Type:   "about:blank",
+			Title:  http.StatusText(status),
+			Status: status,
+			Detail: fmt.Sprintf("%d validation error(s)", len(errs)),
+		},
+	}
+	for _, err := range errs {
+		problem.Errors = append(problem.Errors, fieldProblem{Field: err.Field, Source: err.Source, Error: err.Err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	JSON(w, status, problem)
+}
@@ -0,0 +1,95 @@
+package kami_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+type createUser struct {
+	Name string `json:"name" validate:"required"`
+	Age  int    `json:"age"`
+}
+
+func (u createUser) Validate() error {
+	if u.Age < 0 {
+		return kami.FieldError{Field: "Age", Source: "body", Err: errors.New("can't be negative")}
+	}
+	return nil
+}
+
+func TestValidateJSON(t *testing.T) {
+	kami.Reset()
+	kami.Post("/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		w.Write(data)
+	}, kami.ValidateJSON(createUser{}))
+
+	expect := []struct {
+		body, contentType string
+		status            int
+		errors            []string
+	}{
+		{`{"name":"kami","age":3}`, "application/json", http.StatusOK, nil},
+		{`{"age":3}`, "application/json; charset=utf-8", http.StatusBadRequest, []string{"Name"}},
+		{`{"name":"kami","age":-1}`, "application/json", http.StatusBadRequest, []string{"Age"}},
+		{`{"name":`, "application/json", http.StatusBadRequest, []string{""}},
+		{`{"name":"kami","age":"old"}`, "application/json", http.StatusBadRequest, []string{"age"}},
+		{``, "application/json", http.StatusBadRequest, []string{""}},
+		{`name=kami`, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType, nil},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/users", strings.NewReader(e.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", e.contentType)
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.body, resp.Code, "≠", e.status)
+			continue
+		}
+		switch e.status {
+		case http.StatusOK:
+			if resp.Body.String() != e.body {
+				t.Error("handler should get the original body:", resp.Body.String())
+			}
+		case http.StatusBadRequest:
+			var problem struct {
+				Status int
+				Errors []struct{ Field, Source, Error string }
+			}
+			if err := json.Unmarshal(resp.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Status != http.StatusBadRequest || len(problem.Errors) != len(e.errors) {
+				t.Error("unexpected problem for", e.body, problem)
+				continue
+			}
+			for i, field := range e.errors {
+				if problem.Errors[i].Field != field || problem.Errors[i].Source != "body" {
+					t.Error("unexpected error for", e.body, problem.Errors[i])
+				}
+			}
+		}
+	}
+}
+
+func TestValidateJSONNil(t *testing.T) {
+	defer func() {
+		if msg, ok := recover().(string); !ok || !strings.HasPrefix(msg, "kami: ") {
+			t.Error("ValidateJSON(nil) should panic with a kami message, got", msg)
+		}
+	}()
+	kami.ValidateJSON(nil)
+}
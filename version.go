@@ -0,0 +1,69 @@
+package kami
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// APIVersion returns middleware that finds the API version a request wants and rejects unsupported ones
+// with 406 Not Acceptable. The version can be given with the v query parameter, or in the given header.
+// For header values that are media types like application/vnd.myapi.v2+json (usually in Accept), the version is "v2";
+// otherwise, the whole header value is the version.
+// A leading "v" is ignored when comparing, so "2" and "v2" are the same version.
+// Requests that don't ask for a version get the first supported one.
+// Handlers can use Version to get the result, which is always one of supported, as given.
+func APIVersion(header string, supported ...string) Middleware {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		want := r.URL.Query().Get("v")
+		if want == "" {
+			want = versionFromHeader(r.Header.Get(header))
+		}
+		if want == "" && len(supported) > 0 {
+			return newContextWithVersion(ctx, supported[0])
+		}
+
+		for _, v := range supported {
+			if strings.EqualFold(strings.TrimPrefix(v, "v"), strings.TrimPrefix(want, "v")) {
+				return newContextWithVersion(ctx, v)
+			}
+		}
+		ClientError(ctx, w, http.StatusNotAcceptable, "unsupported API version "+strconv.Quote(want))
+		return nil
+	}
+}
+
+// versionFromHeader finds the version in a header value.
+func versionFromHeader(value string) string {
+	if !strings.Contains(value, "/") {
+		return strings.TrimSpace(value)
+	}
+	// media types like application/vnd.myapi.v2+json
+	for _, part := range strings.Split(value, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		i := strings.Index(mediaType, "/vnd.")
+		if i == -1 {
+			continue
+		}
+		name := mediaType[i+len("/vnd."):]
+		if plus := strings.Index(name, "+"); plus != -1 {
+			name = name[:plus]
+		}
+		if dot := strings.LastIndex(name, "."); dot != -1 && strings.HasPrefix(name[dot+1:], "v") {
+			return name[dot+1:]
+		}
+	}
+	return ""
+}
+
+// Version returns the API version chosen by APIVersion, or a blank string if there isn't one.
+func Version(ctx context.Context) string {
+	v, _ := ctx.Value(versionKey).(string)
+	return v
+}
+
+func newContextWithVersion(ctx context.Context, v string) context.Context {
+	return context.WithValue(ctx, versionKey, v)
+}
@@ -0,0 +1,68 @@
+package kami_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestAPIVersion(t *testing.T) {
+	kami.Reset()
+	kami.Use("/api/", kami.APIVersion("Accept", "v2", "v1"))
+	kami.Get("/api/users", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, kami.Version(ctx))
+	})
+
+	expect := []struct {
+		path, accept string
+		status       int
+		version      string
+	}{
+		{"/api/users", "", http.StatusOK, "v2"},
+		{"/api/users", "application/json", http.StatusOK, "v2"},
+		{"/api/users", "application/vnd.myapi.v1+json", http.StatusOK, "v1"},
+		{"/api/users", "text/html, application/vnd.myapi.v2+json; q=0.9", http.StatusOK, "v2"},
+		{"/api/users?v=1", "application/vnd.myapi.v2+json", http.StatusOK, "v1"},
+		{"/api/users", "application/vnd.myapi.v3+json", http.StatusNotAcceptable, ""},
+		{"/api/users?v=0", "", http.StatusNotAcceptable, ""},
+	}
+	for _, e := range expect {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", e.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", e.accept)
+
+		kami.Handler().ServeHTTP(resp, req)
+		if resp.Code != e.status {
+			t.Error("unexpected status for", e.path, e.accept, resp.Code, "≠", e.status)
+			continue
+		}
+		if e.status == http.StatusOK && resp.Body.String() != e.version {
+			t.Error("unexpected version for", e.path, e.accept, resp.Body.String(), "≠", e.version)
+		}
+	}
+
+	// plain headers
+	kami.Reset()
+	kami.Use("/", kami.APIVersion("X-API-Version", "1", "2"))
+	kami.Get("/thing", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, kami.Version(ctx))
+	})
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/thing", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Version", "2")
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Body.String() != "2" {
+		t.Error("unexpected version:", resp.Body.String())
+	}
+}
@@ -0,0 +1,46 @@
+package kami
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketHandler handles a WebSocket connection. The connection is closed when it returns.
+type WebSocketHandler func(context.Context, *websocket.Conn)
+
+// WebSocket registers a WebSocket handler under the given path, with optional route middleware.
+// The whole middleware chain runs before the handshake, just like for any other GET route,
+// so middleware that rejects the request (such as auth) prevents the upgrade.
+// The request stays open until the handler returns, at which point afterware and LogHandler run,
+// seeing a status of 101 Switching Protocols (or 400 Bad Request if the handshake failed).
+// The Origin header isn't checked, so use middleware for that if you need it.
+func WebSocket(path string, handle WebSocketHandler, mw ...Middleware) {
+	Get(path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if _, ok := hijackerFor(ctx, w); !ok {
+			renderError(ctx, w, r, http.StatusInternalServerError)
+			return
+		}
+		SetStatus(ctx, http.StatusBadRequest)
+		srv := websocket.Server{
+			Handler: func(ws *websocket.Conn) {
+				SetStatus(ctx, http.StatusSwitchingProtocols)
+				handle(ctx, ws)
+			},
+		}
+		srv.ServeHTTP(wsHijacker{w, ctx}, r)
+	}, mw...)
+}
+
+// wsHijacker hijacks with Hijack, so kami knows the connection is gone.
+type wsHijacker struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+func (h wsHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return Hijack(h.ctx, h.ResponseWriter)
+}
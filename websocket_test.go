@@ -0,0 +1,145 @@
+package kami_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+
+	"github.com/guregu/kami"
+)
+
+func TestWebSocket(t *testing.T) {
+	kami.Reset()
+	statuses := make(chan int, 1)
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		statuses <- w.Status()
+	}
+	kami.Use("/ws/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) context.Context {
+		if r.URL.Query().Get("token") != "secret" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return nil
+		}
+		return ctx
+	})
+	handshakes := 0
+	kami.WebSocket("/ws/echo", func(ctx context.Context, ws *websocket.Conn) {
+		handshakes++
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			t.Error(err)
+			return
+		}
+		websocket.Message.Send(ws, "echo: "+msg)
+	})
+
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/echo"
+
+	// rejected before the handshake
+	resp, err := http.Get(srv.URL + "/ws/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("should return HTTP StatusUnauthorized(401)", resp.StatusCode, "≠", http.StatusUnauthorized)
+	}
+	if status := <-statuses; status != http.StatusUnauthorized {
+		t.Error("should log HTTP StatusUnauthorized(401)", status, "≠", http.StatusUnauthorized)
+	}
+	if _, err := websocket.Dial(wsURL, "", srv.URL); err == nil {
+		t.Error("unauthorized handshake should fail")
+	}
+	<-statuses
+	if handshakes != 0 {
+		t.Error("handler shouldn't run without auth")
+	}
+
+	// accepted
+	ws, err := websocket.Dial(wsURL+"?token=secret", "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.Message.Send(ws, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	if err := websocket.Message.Receive(ws, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "echo: hello" {
+		t.Error("unexpected reply:", reply)
+	}
+	ws.Close()
+	if status := <-statuses; status != http.StatusSwitchingProtocols {
+		t.Error("should log HTTP StatusSwitchingProtocols(101) when the connection closes", status, "≠", http.StatusSwitchingProtocols)
+	}
+}
+
+func TestWebSocketBehindSetWriter(t *testing.T) {
+	kami.Reset()
+	closed := make(chan struct{})
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		close(closed)
+	}
+	// these replace the writer with ones that don't hijack
+	kami.Use("/", kami.Charset(""))
+	kami.Use("/", kami.Compress())
+	kami.Use("/", kami.FilterResponseHeaders(kami.HeaderFilterOptions{Remove: []string{"X-Powered-By"}}))
+	kami.WebSocket("/ws", func(ctx context.Context, ws *websocket.Conn) {
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			t.Error(err)
+			return
+		}
+		websocket.Message.Send(ws, "echo: "+msg)
+	})
+
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.Message.Send(ws, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	if err := websocket.Message.Receive(ws, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != "echo: hello" {
+		t.Error("unexpected reply:", reply)
+	}
+	ws.Close()
+	<-closed
+}
+
+func TestWebSocketNoHijacker(t *testing.T) {
+	kami.Reset()
+	kami.ErrorRenderer = func(ctx context.Context, w http.ResponseWriter, r *http.Request, status int) {
+		w.WriteHeader(status)
+		w.Write([]byte("rendered"))
+	}
+	kami.WebSocket("/ws", func(ctx context.Context, ws *websocket.Conn) {
+		t.Error("handler shouldn't run without a hijackable connection")
+	})
+
+	// recorders can't be hijacked
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if resp.Code != http.StatusInternalServerError || resp.Body.String() != "rendered" {
+		t.Error("should render a 500 error with ErrorRenderer", resp.Code, resp.Body.String())
+	}
+}
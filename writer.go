@@ -0,0 +1,309 @@
+package kami
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+)
+
+// SetWriter replaces the response writer given to the rest of the middleware and the handler,
+// for middleware that needs to transform the response, like compression.
+// w should wrap the writer the middleware was given.
+// If w is an io.Closer, it is closed after the handler returns (or panics), before afterware runs.
+// Afterware and LogHandler still get kami's own writer, so they see what was actually sent.
+// SetWriter does nothing if ctx didn't come from kami.
+func SetWriter(ctx context.Context, w http.ResponseWriter) {
+	req := requestFrom(ctx)
+	if req == nil {
+		return
+	}
+	req.writer = w
+	if c, ok := w.(io.Closer); ok {
+		req.closers = append(req.closers, c)
+	}
+}
+
+// writerProxy is kami's mutil.WriterProxy.
+// Unlike mutil.WrapWriter, wrapWriter keeps every optional interface of the underlying writer
+// (http.Flusher, http.Hijacker, http.Pusher, http.CloseNotifier), so handlers behind
+// afterware or LogHandler can still stream, upgrade to websockets, and push.
+type writerProxy struct {
+	http.ResponseWriter
+	// req is used for the status hint from SetStatus.
+	req         *request
+	wroteHeader bool
+	code        int
+	bytes       int
+	tee         io.Writer
+}
+
+func (p *writerProxy) WriteHeader(code int) {
+	if !p.wroteHeader {
+		p.code = code
+		p.wroteHeader = true
+		p.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (p *writerProxy) Write(buf []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	n, err := p.ResponseWriter.Write(buf)
+	if p.tee != nil {
+		_, err2 := p.tee.Write(buf[:n])
+		// prefer errors from the real writer
+		if err == nil {
+			err = err2
+		}
+	}
+	p.bytes += n
+	return n, err
+}
+
+// ReadFrom uses the underlying writer's ReadFrom if it has one, for things like sendfile.
+func (p *writerProxy) ReadFrom(r io.Reader) (int64, error) {
+	rf, ok := p.ResponseWriter.(io.ReaderFrom)
+	if !ok || p.tee != nil {
+		return io.Copy(writerOnly{p}, r)
+	}
+	p.WriteHeader(http.StatusOK)
+	n, err := rf.ReadFrom(r)
+	p.bytes += int(n)
+	return n, err
+}
+
+func (p *writerProxy) Status() int {
+	if p.req != nil && p.req.status != 0 {
+		return p.req.status
+	}
+	return p.code
+}
+
+func (p *writerProxy) BytesWritten() int {
+	return p.bytes
+}
+
+func (p *writerProxy) Tee(w io.Writer) {
+	p.tee = w
+}
+
+func (p *writerProxy) headerWritten() bool {
+	return p.wroteHeader
+}
+
+// headerWritten reports whether a status has been written to w, a writer made by wrapWriter.
+func headerWritten(w mutil.WriterProxy) bool {
+	hw, ok := w.(interface{ headerWritten() bool })
+	return ok && hw.headerWritten()
+}
+
+func (p *writerProxy) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
+
+// SetStatus records the status of the response for afterware and LogHandler,
+// which will see it from WriterProxy.Status instead of the status that was actually written.
+// This is for handlers that respond in ways kami can't observe, like hijacking the connection for a websocket.
+// Normal handlers don't need it, since kami sees their WriteHeader.
+// SetStatus does nothing if ctx didn't come from kami.
+func SetStatus(ctx context.Context, code int) {
+	if req := requestFrom(ctx); req != nil {
+		req.status = code
+	}
+}
+
+// writerOnly hides ReadFrom so io.Copy doesn't loop back into it.
+type writerOnly struct {
+	io.Writer
+}
+
+// flusher sends the status before flushing, so WriterProxy.Status is accurate for streaming responses.
+type flusher struct {
+	p *writerProxy
+}
+
+func (f flusher) Flush() {
+	f.p.WriteHeader(http.StatusOK)
+	f.p.ResponseWriter.(http.Flusher).Flush()
+}
+
+// hijacker marks the header as written after a hijack, so nothing tries to write to the connection afterwards.
+type hijacker struct {
+	p *writerProxy
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := h.p.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		h.p.wroteHeader = true
+		if h.p.req != nil {
+			h.p.req.hijacked = true
+		}
+	}
+	return conn, rw, err
+}
+
+// Hijack takes over the request's connection, for protocols layered over HTTP.
+// It's like w.(http.Hijacker).Hijack(), but also tells kami that the connection is gone,
+// so kami won't try to write an error or status to it afterwards.
+// Afterware and LogHandler still run, but can't respond to the request, and see a status of 0;
+// use SetStatus to give them something to log.
+// It finds the http.Hijacker even if middleware has replaced the writer with SetWriter.
+// An error is returned if w can't be hijacked, such as with HTTP/2.
+func Hijack(ctx context.Context, w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := hijackerFor(ctx, w)
+	if !ok {
+		return nil, nil, errors.New("kami: response writer can't be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		if req := requestFrom(ctx); req != nil {
+			req.hijacked = true
+		}
+	}
+	return conn, rw, err
+}
+
+// hijackerFor finds the http.Hijacker for w, looking through writers that can Unwrap,
+// and then at the writer from before SetWriter, since writers from SetWriter usually hide it.
+func hijackerFor(ctx context.Context, w http.ResponseWriter) (http.Hijacker, bool) {
+	for w != nil {
+		if hj, ok := w.(http.Hijacker); ok {
+			return hj, true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	if req := requestFrom(ctx); req != nil {
+		hj, ok := req.root.(http.Hijacker)
+		return hj, ok
+	}
+	return nil, false
+}
+
+func wrapWriter(w http.ResponseWriter, req *request) mutil.WriterProxy {
+	p := &writerProxy{ResponseWriter: w, req: req}
+
+	_, isFl := w.(http.Flusher)
+	_, isHj := w.(http.Hijacker)
+	fl, hj := flusher{p}, hijacker{p}
+	pu, isPu := w.(http.Pusher)
+	cn, isCn := w.(http.CloseNotifier)
+
+	var which int
+	if isFl {
+		which |= 1
+	}
+	if isHj {
+		which |= 2
+	}
+	if isPu {
+		which |= 4
+	}
+	if isCn {
+		which |= 8
+	}
+
+	switch which {
+	case 1:
+		return struct {
+			*writerProxy
+			http.Flusher
+		}{p, fl}
+	case 2:
+		return struct {
+			*writerProxy
+			http.Hijacker
+		}{p, hj}
+	case 1 | 2:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Hijacker
+		}{p, fl, hj}
+	case 4:
+		return struct {
+			*writerProxy
+			http.Pusher
+		}{p, pu}
+	case 1 | 4:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Pusher
+		}{p, fl, pu}
+	case 2 | 4:
+		return struct {
+			*writerProxy
+			http.Hijacker
+			http.Pusher
+		}{p, hj, pu}
+	case 1 | 2 | 4:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{p, fl, hj, pu}
+	case 8:
+		return struct {
+			*writerProxy
+			http.CloseNotifier
+		}{p, cn}
+	case 1 | 8:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.CloseNotifier
+		}{p, fl, cn}
+	case 2 | 8:
+		return struct {
+			*writerProxy
+			http.Hijacker
+			http.CloseNotifier
+		}{p, hj, cn}
+	case 1 | 2 | 8:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Hijacker
+			http.CloseNotifier
+		}{p, fl, hj, cn}
+	case 4 | 8:
+		return struct {
+			*writerProxy
+			http.Pusher
+			http.CloseNotifier
+		}{p, pu, cn}
+	case 1 | 4 | 8:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Pusher
+			http.CloseNotifier
+		}{p, fl, pu, cn}
+	case 2 | 4 | 8:
+		return struct {
+			*writerProxy
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier
+		}{p, hj, pu, cn}
+	case 1 | 2 | 4 | 8:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier
+		}{p, fl, hj, pu, cn}
+	}
+	return p
+}
@@ -0,0 +1,154 @@
+package kami_test
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zenazn/goji/web/mutil"
+	"golang.org/x/net/context"
+
+	"github.com/guregu/kami"
+)
+
+func TestWriterProxyInterfaces(t *testing.T) {
+	kami.Reset()
+	statuses := make(chan int, 1)
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		statuses <- w.Status()
+	}
+	kami.Get("/flush", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Error("writer should be an http.Flusher")
+			return
+		}
+		f.Flush()
+		io.WriteString(w, "data: hello\n\n")
+		if _, ok := w.(http.Hijacker); ok {
+			t.Error("writer shouldn't be an http.Hijacker when the underlying writer isn't")
+		}
+	})
+	kami.Get("/hijack", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("writer should be an http.Hijacker")
+			return
+		}
+		conn, rw, err := hj.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})
+
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/flush", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(resp, req)
+	if !resp.Flushed {
+		t.Error("response should have been flushed")
+	}
+	if status := <-statuses; status != http.StatusOK {
+		t.Error("flushing should send StatusOK(200)", status, "≠", http.StatusOK)
+	}
+
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+	hresp, err := http.Get(srv.URL + "/hijack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hresp.Body.Close()
+	line, _ := bufio.NewReader(hresp.Body).ReadString('\n')
+	if line != "hijacked" {
+		t.Error("unexpected body:", line)
+	}
+	// the client is done before the handler is, and the server doesn't wait for hijacked connections
+	<-statuses
+}
+
+func TestSetStatus(t *testing.T) {
+	kami.Reset()
+	statuses := make(chan int, 1)
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		statuses <- w.Status()
+	}
+	kami.Get("/upgrade", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		kami.SetStatus(ctx, http.StatusSwitchingProtocols)
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+	})
+
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Error("should return HTTP StatusSwitchingProtocols(101)", resp.StatusCode, "≠", http.StatusSwitchingProtocols)
+	}
+	if status := <-statuses; status != http.StatusSwitchingProtocols {
+		t.Error("log handler should see the status from SetStatus", status, "≠", http.StatusSwitchingProtocols)
+	}
+}
+
+func TestHijack(t *testing.T) {
+	kami.Reset()
+	logged := make(chan int, 1)
+	kami.LogHandler = func(ctx context.Context, w mutil.WriterProxy, r *http.Request) {
+		logged <- w.Status()
+	}
+	kami.Get("/raw", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := kami.Hijack(ctx, w)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 3\r\nConnection: close\r\n\r\nraw")
+		rw.Flush()
+	})
+
+	srv := httptest.NewServer(kami.Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error("should return HTTP StatusOK(200)", resp.StatusCode, "≠", http.StatusOK)
+	}
+	if status := <-logged; status != 0 {
+		t.Error("log handler shouldn't see a status without SetStatus:", status)
+	}
+
+	// recorders can't be hijacked
+	kami.LogHandler = nil
+	kami.Get("/nope", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if _, _, err := kami.Hijack(ctx, w); err == nil {
+			t.Error("expected an error")
+		}
+	})
+	req, err := http.NewRequest("GET", "/nope", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kami.Handler().ServeHTTP(httptest.NewRecorder(), req)
+}